@@ -24,3 +24,19 @@ func PublishNotification(recipientID int64, payload []byte) {
 		// drop if busy
 	}
 }
+
+var disconnectHandler func(userID int64)
+
+// SetDisconnectHandler registers the function that drops a user's realtime
+// connection. It is set by the websocket server at startup.
+func SetDisconnectHandler(fn func(userID int64)) {
+	disconnectHandler = fn
+}
+
+// DisconnectUser closes the user's websocket connection, if any. Unlike
+// notifications this is never dropped: it runs synchronously.
+func DisconnectUser(userID int64) {
+	if disconnectHandler != nil {
+		disconnectHandler(userID)
+	}
+}
@@ -0,0 +1,241 @@
+package config
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds runtime settings read from environment variables at startup.
+type Config struct {
+	// AppBaseURL is the public URL of the frontend, used to build links in emails.
+	AppBaseURL string
+
+	// AllowedOrigins are the browser origins (scheme://host[:port]) of the
+	// frontend, allowed by CORS and by the CSRF check. The backend's own
+	// origin is always allowed.
+	AllowedOrigins []string
+	// CSRFProtection is "origin" (verify Origin/Referer on state-changing
+	// cookie requests) or "off".
+	CSRFProtection string
+	// WSAllowedOrigins are the origins allowed to open the WebSocket; "*"
+	// allows any. Defaults to AllowedOrigins.
+	WSAllowedOrigins []string
+
+	// PasswordResetTTL is how long a password reset link stays valid.
+	PasswordResetTTL time.Duration
+
+	// EmailVerificationTTL is how long an email verification link stays valid.
+	EmailVerificationTTL time.Duration
+	// UnverifiedRestrictions lists the actions ("post", "comment", "message",
+	// "group") blocked until a user has verified their email address.
+	UnverifiedRestrictions []string
+
+	// AccountDeletionGrace is how long a deletion request can still be cancelled
+	// (by logging in) before the account and its data are purged.
+	AccountDeletionGrace time.Duration
+
+	// DataExportDir is where generated personal data archives are written.
+	DataExportDir string
+	// DataExportTTL is how long a finished archive can be downloaded before it is removed.
+	DataExportTTL time.Duration
+
+	// RegistrationMode is "open", "invite" (an invite code is required) or
+	// "domain" (the email must be in RegistrationDomains, unless the user has
+	// an invite code).
+	RegistrationMode    string
+	RegistrationDomains []string
+	// MemberInvites lets every user mint invite codes, not only admins.
+	MemberInvites bool
+
+	// ReactionEmojis are the emoji users can react with besides "like".
+	ReactionEmojis []string
+
+	// AdminEmails are promoted to the admin role once their address is
+	// verified; this is how the first admin is bootstrapped.
+	AdminEmails []string
+
+	// TOTPIssuer is the account issuer shown in authenticator apps.
+	TOTPIssuer string
+	// MFAChallengeTTL is how long a user has to enter their second factor after the password step.
+	MFAChallengeTTL time.Duration
+
+	// JWTKeys are the access token keys as "kid:alg:base64key" (alg HS256 or
+	// EdDSA); JWTSigningKey names the one new tokens are signed with (default
+	// the first). Without keys an ephemeral key is generated at startup.
+	JWTKeys       []string
+	JWTSigningKey string
+	// AccessTokenTTL and RefreshTokenTTL are the lifetimes of API tokens.
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+
+	// RateLimitStore selects where limiter state lives: "memory" or "sqlite".
+	RateLimitStore string
+	// TrustedProxies are the addresses or CIDR ranges of reverse proxies
+	// whose X-Forwarded-For and X-Real-IP headers are believed. Requests
+	// from anywhere else are identified by their socket address.
+	TrustedProxies []string
+	// Progressive login lockout: after LoginMaxFailures failed passwords the
+	// identifier is locked for LoginLockoutBase, doubling per extra failure up
+	// to LoginLockoutMax.
+	LoginMaxFailures int
+	LoginLockoutBase time.Duration
+	LoginLockoutMax  time.Duration
+
+	// Mail settings; MailDriver is "smtp", "file" or "log".
+	MailDriver   string
+	MailFrom     string
+	MailDir      string
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+}
+
+// Current is the active configuration. It starts out with defaults so that
+// packages work without calling Load (e.g. in tests).
+var Current = defaults()
+
+func defaults() Config {
+	return Config{
+		AppBaseURL:             "http://localhost:5173",
+		AllowedOrigins:         []string{"http://localhost:5173", "http://localhost:5174"},
+		CSRFProtection:         "origin",
+		PasswordResetTTL:       time.Hour,
+		EmailVerificationTTL:   48 * time.Hour,
+		UnverifiedRestrictions: []string{"post", "message"},
+		AccountDeletionGrace:   14 * 24 * time.Hour,
+		DataExportDir:          "backend/exports",
+		DataExportTTL:          7 * 24 * time.Hour,
+		RegistrationMode:       "open",
+		ReactionEmojis:         []string{"❤️", "😂", "😮", "😢", "😡"},
+		TOTPIssuer:             "Social Network",
+		MFAChallengeTTL:        5 * time.Minute,
+		AccessTokenTTL:         15 * time.Minute,
+		RefreshTokenTTL:        30 * 24 * time.Hour,
+		RateLimitStore:         "memory",
+		LoginMaxFailures:       5,
+		LoginLockoutBase:       30 * time.Second,
+		LoginLockoutMax:        time.Hour,
+		MailDriver:             "log",
+		MailFrom:               "no-reply@localhost",
+		MailDir:                "backend/mail",
+		SMTPPort:               "587",
+	}
+}
+
+// Load reads the configuration from the environment, falling back to defaults
+// for anything unset or invalid.
+func Load() {
+	c := defaults()
+	c.AppBaseURL = strings.TrimRight(envString("APP_BASE_URL", c.AppBaseURL), "/")
+	c.AllowedOrigins = envList("ALLOWED_ORIGINS", c.AllowedOrigins)
+	c.CSRFProtection = strings.ToLower(envString("CSRF_PROTECTION", c.CSRFProtection))
+	c.WSAllowedOrigins = envList("WS_ALLOWED_ORIGINS", c.AllowedOrigins)
+	c.PasswordResetTTL = envDuration("PASSWORD_RESET_TTL", c.PasswordResetTTL)
+	c.EmailVerificationTTL = envDuration("EMAIL_VERIFICATION_TTL", c.EmailVerificationTTL)
+	c.UnverifiedRestrictions = envList("UNVERIFIED_RESTRICTIONS", c.UnverifiedRestrictions)
+	c.AccountDeletionGrace = envDuration("ACCOUNT_DELETION_GRACE", c.AccountDeletionGrace)
+	c.DataExportDir = envString("DATA_EXPORT_DIR", c.DataExportDir)
+	c.DataExportTTL = envDuration("DATA_EXPORT_TTL", c.DataExportTTL)
+	c.RegistrationMode = strings.ToLower(envString("REGISTRATION_MODE", c.RegistrationMode))
+	c.RegistrationDomains = envList("REGISTRATION_DOMAINS", c.RegistrationDomains)
+	c.MemberInvites = envBool("MEMBER_INVITES", c.MemberInvites)
+	c.ReactionEmojis = envKeyList("REACTION_EMOJIS", c.ReactionEmojis)
+	c.AdminEmails = envList("ADMIN_EMAILS", c.AdminEmails)
+	c.TOTPIssuer = envString("TOTP_ISSUER", c.TOTPIssuer)
+	c.MFAChallengeTTL = envDuration("MFA_CHALLENGE_TTL", c.MFAChallengeTTL)
+	c.JWTKeys = envKeyList("JWT_KEYS", c.JWTKeys)
+	c.JWTSigningKey = envString("JWT_SIGNING_KEY", c.JWTSigningKey)
+	c.AccessTokenTTL = envDuration("ACCESS_TOKEN_TTL", c.AccessTokenTTL)
+	c.RefreshTokenTTL = envDuration("REFRESH_TOKEN_TTL", c.RefreshTokenTTL)
+	c.RateLimitStore = strings.ToLower(envString("RATE_LIMIT_STORE", c.RateLimitStore))
+	c.TrustedProxies = envList("TRUSTED_PROXIES", c.TrustedProxies)
+	c.LoginMaxFailures = envInt("LOGIN_MAX_FAILURES", c.LoginMaxFailures)
+	c.LoginLockoutBase = envDuration("LOGIN_LOCKOUT_BASE", c.LoginLockoutBase)
+	c.LoginLockoutMax = envDuration("LOGIN_LOCKOUT_MAX", c.LoginLockoutMax)
+	c.MailDriver = strings.ToLower(envString("MAIL_DRIVER", c.MailDriver))
+	c.MailFrom = envString("MAIL_FROM", c.MailFrom)
+	c.MailDir = envString("MAIL_DIR", c.MailDir)
+	c.SMTPHost = envString("SMTP_HOST", c.SMTPHost)
+	c.SMTPPort = envString("SMTP_PORT", c.SMTPPort)
+	c.SMTPUsername = envString("SMTP_USERNAME", c.SMTPUsername)
+	c.SMTPPassword = envString("SMTP_PASSWORD", c.SMTPPassword)
+	Current = c
+}
+
+func envString(key, def string) string {
+	if v := strings.TrimSpace(os.Getenv(key)); v != "" {
+		return v
+	}
+	return def
+}
+
+// envList parses a comma-separated, case-insensitive list. Setting the
+// variable to "none" yields an empty list.
+func envList(key string, def []string) []string {
+	return envListFunc(key, def, strings.ToLower)
+}
+
+// envKeyList is like envList but keeps entries as written (e.g. keys).
+func envKeyList(key string, def []string) []string {
+	return envListFunc(key, def, func(s string) string { return s })
+}
+
+func envListFunc(key string, def []string, norm func(string) string) []string {
+	v, ok := os.LookupEnv(key)
+	if !ok || strings.TrimSpace(v) == "" {
+		return def
+	}
+	if strings.EqualFold(strings.TrimSpace(v), "none") {
+		return nil
+	}
+	var out []string
+	for _, part := range strings.Split(v, ",") {
+		if p := norm(strings.TrimSpace(part)); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func envDuration(key string, def time.Duration) time.Duration {
+	v := strings.TrimSpace(os.Getenv(key))
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Printf("Invalid duration for %s=%q, using %s", key, v, def)
+		return def
+	}
+	return d
+}
+
+func envInt(key string, def int) int {
+	v := strings.TrimSpace(os.Getenv(key))
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Printf("Invalid integer for %s=%q, using %d", key, v, def)
+		return def
+	}
+	return n
+}
+
+func envBool(key string, def bool) bool {
+	v := strings.TrimSpace(os.Getenv(key))
+	if v == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		log.Printf("Invalid boolean for %s=%q, using %t", key, v, def)
+		return def
+	}
+	return b
+}
@@ -0,0 +1,8 @@
+-- Track per-device metadata so a user can hold several sessions at once
+ALTER TABLE sessions ADD COLUMN user_agent TEXT;
+ALTER TABLE sessions ADD COLUMN ip_address TEXT;
+ALTER TABLE sessions ADD COLUMN created_at DATETIME;
+ALTER TABLE sessions ADD COLUMN last_seen_at DATETIME;
+
+CREATE INDEX IF NOT EXISTS idx_sessions_cookie_token ON sessions (cookie_token);
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions (user_id);
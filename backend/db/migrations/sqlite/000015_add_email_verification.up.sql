@@ -0,0 +1,18 @@
+ALTER TABLE users ADD COLUMN verified_at DATETIME;
+
+CREATE TABLE IF NOT EXISTS email_verifications (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    email TEXT NOT NULL, -- the address this token confirms
+    token_hash TEXT NOT NULL UNIQUE,
+    expires_at DATETIME NOT NULL,
+    used_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+-- Accounts created before verification existed are treated as verified.
+-- Every new registration gets an email_verifications row, so re-running this
+-- statement never verifies an account that is still pending.
+UPDATE users SET verified_at = CURRENT_TIMESTAMP
+WHERE verified_at IS NULL AND id NOT IN (SELECT user_id FROM email_verifications);
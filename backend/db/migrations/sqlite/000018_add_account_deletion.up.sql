@@ -0,0 +1,3 @@
+-- Set when a user asks to delete their account; the purge job removes the
+-- account once this time has passed unless the user logs in again first.
+ALTER TABLE users ADD COLUMN deletion_scheduled_at DATETIME;
@@ -0,0 +1,3 @@
+-- suspended_at set with suspended_until NULL is a permanent ban
+ALTER TABLE users ADD COLUMN suspended_until DATETIME;
+ALTER TABLE users ADD COLUMN suspended_by INTEGER;
@@ -0,0 +1,28 @@
+-- Append-only security audit log. Each entry's hash covers its content and
+-- the previous entry's hash, so editing or removing a row breaks the chain.
+CREATE TABLE IF NOT EXISTS audit_log (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER, -- whose history the entry belongs to
+    actor_id INTEGER, -- who did it; NULL for the system
+    action TEXT NOT NULL, -- e.g. "login.success", "admin.suspend"
+    ip_address TEXT,
+    user_agent TEXT,
+    data TEXT, -- JSON details
+    created_at TEXT NOT NULL, -- fixed-width UTC timestamp, part of the hash
+    prev_hash TEXT NOT NULL,
+    hash TEXT NOT NULL UNIQUE
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_user ON audit_log (user_id, id);
+CREATE INDEX IF NOT EXISTS idx_audit_log_actor ON audit_log (actor_id, id);
+CREATE INDEX IF NOT EXISTS idx_audit_log_action ON audit_log (action, id);
+
+CREATE TRIGGER IF NOT EXISTS audit_log_no_update BEFORE UPDATE ON audit_log
+BEGIN
+    SELECT RAISE(ABORT, 'audit_log is append-only');
+END;
+
+CREATE TRIGGER IF NOT EXISTS audit_log_no_delete BEFORE DELETE ON audit_log
+BEGIN
+    SELECT RAISE(ABORT, 'audit_log is append-only');
+END;
@@ -0,0 +1,28 @@
+-- Users selected to see a "private" post. Replaces posts.allowed_user_ids,
+-- which is no longer written.
+CREATE TABLE IF NOT EXISTS post_audience (
+    post_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    PRIMARY KEY (post_id, user_id),
+    FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_audience_user ON post_audience (user_id, post_id);
+
+-- Copy the comma-separated lists over. Safe to re-run: existing pairs are
+-- skipped, and entries that aren't ids of existing users are dropped.
+WITH RECURSIVE split (post_id, item, rest) AS (
+    SELECT id, '', allowed_user_ids || ','
+    FROM posts
+    WHERE privacy = 'private' AND TRIM(IFNULL(allowed_user_ids, '')) != ''
+    UNION ALL
+    SELECT post_id, TRIM(SUBSTR(rest, 1, INSTR(rest, ',') - 1)), SUBSTR(rest, INSTR(rest, ',') + 1)
+    FROM split
+    WHERE rest != ''
+)
+INSERT OR IGNORE INTO post_audience (post_id, user_id)
+SELECT post_id, CAST(item AS INTEGER)
+FROM split
+WHERE item != '' AND item NOT GLOB '*[^0-9]*'
+    AND CAST(item AS INTEGER) IN (SELECT id FROM users);
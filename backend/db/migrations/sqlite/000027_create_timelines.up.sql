@@ -0,0 +1,32 @@
+-- Materialized home timelines: one row per post per user whose feed it
+-- belongs in, written by the fan-out worker when the post is created.
+CREATE TABLE IF NOT EXISTS timelines (
+    user_id INTEGER NOT NULL,
+    post_id INTEGER NOT NULL,
+    author_id INTEGER NOT NULL,
+    created_at TEXT NOT NULL, -- copy of posts.created_at, for ordering
+    PRIMARY KEY (user_id, post_id),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_timelines_feed ON timelines (user_id, created_at DESC, post_id DESC);
+CREATE INDEX IF NOT EXISTS idx_timelines_post ON timelines (post_id);
+CREATE INDEX IF NOT EXISTS idx_timelines_author ON timelines (author_id, user_id);
+
+-- set once a post has been fanned out; posts left NULL are picked up again at startup
+ALTER TABLE posts ADD COLUMN fanned_out_at DATETIME;
+
+-- fan out the posts that existed before timelines
+INSERT OR IGNORE INTO timelines (user_id, post_id, author_id, created_at)
+SELECT p.author_id, p.id, p.author_id, p.created_at FROM posts p WHERE p.fanned_out_at IS NULL
+UNION ALL
+SELECT f.follower_id, p.id, p.author_id, p.created_at
+FROM posts p JOIN followers f ON f.followed_id = p.author_id
+WHERE p.fanned_out_at IS NULL AND p.privacy IN ('public', 'followers')
+UNION ALL
+SELECT a.user_id, p.id, p.author_id, p.created_at
+FROM posts p JOIN post_audience a ON a.post_id = p.id
+WHERE p.fanned_out_at IS NULL AND p.privacy = 'private';
+
+UPDATE posts SET fanned_out_at = CURRENT_TIMESTAMP WHERE fanned_out_at IS NULL;
@@ -0,0 +1,15 @@
+-- Earlier versions of edited posts. Each row is the post as it was before
+-- an edit, stamped with when it was replaced.
+CREATE TABLE IF NOT EXISTS post_revisions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    post_id INTEGER NOT NULL,
+    content TEXT NOT NULL,
+    image_url TEXT,
+    privacy TEXT NOT NULL,
+    replaced_at DATETIME NOT NULL,
+    FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_revisions_post ON post_revisions (post_id, id);
+
+ALTER TABLE posts ADD COLUMN edited_at DATETIME;
@@ -0,0 +1,15 @@
+-- One reaction per user per item. Removing a reaction clears `reaction` but
+-- keeps the row, so notified_at still stops repeat notifications when the
+-- user reacts again.
+CREATE TABLE IF NOT EXISTS reactions (
+    target_type TEXT NOT NULL, -- post, comment, group_post or group_comment
+    target_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    reaction TEXT, -- "like" or one of the configured emoji; NULL once removed
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    notified_at DATETIME,
+    PRIMARY KEY (target_type, target_id, user_id),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_reactions_user ON reactions (user_id);
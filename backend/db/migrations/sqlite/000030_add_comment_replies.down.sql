@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_group_comments_parent;
+DROP INDEX IF EXISTS idx_comments_parent;
+ALTER TABLE group_comments DROP COLUMN parent_id;
+ALTER TABLE comments DROP COLUMN parent_id;
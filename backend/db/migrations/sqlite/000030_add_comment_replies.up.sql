@@ -0,0 +1,6 @@
+-- Replies: a comment with parent_id set answers that comment (on the same post).
+ALTER TABLE comments ADD COLUMN parent_id INTEGER REFERENCES comments (id) ON DELETE CASCADE;
+ALTER TABLE group_comments ADD COLUMN parent_id INTEGER REFERENCES group_comments (id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS idx_comments_parent ON comments (parent_id, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_group_comments_parent ON group_comments (parent_id, created_at, id);
@@ -0,0 +1,6 @@
+ALTER TABLE group_comments DROP COLUMN removed_by;
+ALTER TABLE group_comments DROP COLUMN removed_at;
+ALTER TABLE group_comments DROP COLUMN edited_at;
+ALTER TABLE comments DROP COLUMN removed_by;
+ALTER TABLE comments DROP COLUMN removed_at;
+ALTER TABLE comments DROP COLUMN edited_at;
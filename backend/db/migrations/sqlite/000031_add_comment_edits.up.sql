@@ -0,0 +1,8 @@
+-- Edited and removed comments. A removed comment stays as a tombstone (empty
+-- content) so replies keep their place; the original text is in audit_log.
+ALTER TABLE comments ADD COLUMN edited_at DATETIME;
+ALTER TABLE comments ADD COLUMN removed_at DATETIME;
+ALTER TABLE comments ADD COLUMN removed_by INTEGER;
+ALTER TABLE group_comments ADD COLUMN edited_at DATETIME;
+ALTER TABLE group_comments ADD COLUMN removed_at DATETIME;
+ALTER TABLE group_comments ADD COLUMN removed_by INTEGER;
@@ -0,0 +1,15 @@
+-- One row per @nickname in a piece of content. span_start and span_end are
+-- UTF-16 offsets into the content, as JavaScript indexes strings.
+CREATE TABLE IF NOT EXISTS mentions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    target_type TEXT NOT NULL, -- post, comment, group_post, group_comment, message or group_message
+    target_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL, -- the user mentioned
+    span_start INTEGER NOT NULL,
+    span_end INTEGER NOT NULL,
+    notified_at DATETIME, -- set once the user was told; kept across edits
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_mentions_target ON mentions (target_type, target_id);
+CREATE INDEX IF NOT EXISTS idx_mentions_user ON mentions (user_id);
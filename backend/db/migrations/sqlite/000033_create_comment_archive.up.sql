@@ -0,0 +1,18 @@
+-- The text of edited and removed comments, for moderators to review. Audit
+-- entries only refer to these rows by id and hash, so they can be purged
+-- with the author's account while the audit log stays append-only.
+CREATE TABLE IF NOT EXISTS comment_archive (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    comment_type TEXT NOT NULL, -- comment or group_comment
+    comment_id INTEGER NOT NULL,
+    post_id INTEGER NOT NULL,
+    author_id INTEGER NOT NULL,
+    action TEXT NOT NULL, -- the audit action: comment.edit, comment.delete or comment.remove
+    content TEXT,
+    image_url TEXT,
+    archived_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (author_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_comment_archive_comment ON comment_archive (comment_type, comment_id);
+CREATE INDEX IF NOT EXISTS idx_comment_archive_author ON comment_archive (author_id);
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	"social-network/backend/db"
+	"social-network/backend/mailer"
+	"social-network/backend/utils"
+)
+
+// checkCurrentPassword verifies the user's password and returns their current email.
+func checkCurrentPassword(userID int64, password string) (string, bool) {
+	var email, hashed string
+	if err := db.DB.QueryRow("SELECT email, password FROM users WHERE id = ?", userID).Scan(&email, &hashed); err != nil {
+		return "", false
+	}
+	return email, utils.CheckPassword(hashed, password)
+}
+
+// POST /api/account/password - { current_password, new_password }
+// Every other session of the user is signed out; the current one stays.
+func ChangePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	uid := utils.GetUserIDFromContext(r)
+	if uid == "" {
+		utils.Error(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	userID, _ := strconv.ParseInt(uid, 10, 64)
+
+	var payload struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.CurrentPassword == "" {
+		utils.Error(w, http.StatusBadRequest, "Invalid input")
+		return
+	}
+	if len(payload.NewPassword) < minPasswordLength {
+		utils.Error(w, http.StatusBadRequest, fmt.Sprintf("Password must be at least %d characters", minPasswordLength))
+		return
+	}
+	if _, ok := checkCurrentPassword(userID, payload.CurrentPassword); !ok {
+		utils.Error(w, http.StatusUnauthorized, "Current password is incorrect")
+		return
+	}
+
+	hashed, err := utils.HashPassword(payload.NewPassword)
+	if err != nil {
+		log.Println("Password hash error:", err)
+		utils.Error(w, http.StatusInternalServerError, "Server error")
+		return
+	}
+	if _, err := db.DB.Exec("UPDATE users SET password = ? WHERE id = ?", hashed, userID); err != nil {
+		log.Printf("Password update error for user %d: %v", userID, err)
+		utils.Error(w, http.StatusInternalServerError, "Failed to change password")
+		return
+	}
+	// outstanding reset links were issued for the old password
+	db.DB.Exec("UPDATE password_resets SET used_at = ? WHERE user_id = ? AND used_at IS NULL", time.Now(), userID)
+
+	revoked, err := utils.RevokeUserSessions(userID, utils.GetSessionIDFromContext(r))
+	if err != nil {
+		log.Printf("Failed to revoke other sessions for user %d: %v", userID, err)
+	}
+	// like a reset, API tokens may have been created by whoever had the password
+	if _, err := db.DB.Exec("DELETE FROM personal_access_tokens WHERE user_id = ?", userID); err != nil {
+		log.Printf("Failed to revoke personal access tokens for user %d: %v", userID, err)
+	}
+	Audit(r, "password.change", userID, userID, map[string]interface{}{"sessions_revoked": revoked})
+	utils.JSON(w, http.StatusOK, map[string]interface{}{"status": "password_changed", "sessions_revoked": revoked})
+}
+
+// POST /api/account/email - { password, new_email }
+// The new address only replaces the current one once it has been verified
+// through the link sent to it (see VerifyEmailHandler).
+func ChangeEmailHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	uid := utils.GetUserIDFromContext(r)
+	if uid == "" {
+		utils.Error(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	userID, _ := strconv.ParseInt(uid, 10, 64)
+
+	var payload struct {
+		Password string `json:"password"`
+		NewEmail string `json:"new_email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.Password == "" {
+		utils.Error(w, http.StatusBadRequest, "Invalid input")
+		return
+	}
+	newEmail := strings.ToLower(strings.TrimSpace(payload.NewEmail))
+	if addr, err := mail.ParseAddress(newEmail); err != nil || addr.Address != newEmail {
+		utils.Error(w, http.StatusBadRequest, "Invalid email address")
+		return
+	}
+
+	currentEmail, ok := checkCurrentPassword(userID, payload.Password)
+	if !ok {
+		utils.Error(w, http.StatusUnauthorized, "Password is incorrect")
+		return
+	}
+	if strings.EqualFold(currentEmail, newEmail) {
+		utils.Error(w, http.StatusBadRequest, "That is already your email address")
+		return
+	}
+	var exists int
+	if err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE email = ?)", newEmail).Scan(&exists); err != nil {
+		utils.Error(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if exists != 0 {
+		utils.Error(w, http.StatusConflict, "Email already in use")
+		return
+	}
+
+	if err := SendVerificationEmail(userID, newEmail); err != nil {
+		log.Printf("Failed to send email change verification for user %d: %v", userID, err)
+		utils.Error(w, http.StatusInternalServerError, "Failed to send verification email")
+		return
+	}
+	// let the owner of the current address know, in case this wasn't them
+	go func() {
+		err := mailer.Send(mailer.Message{
+			To:      currentEmail,
+			Subject: "Your email address is being changed",
+			Body: fmt.Sprintf("A request was made to change the email address of your account to %s.\n\n"+
+				"If this wasn't you, reset your password right away.", newEmail),
+		})
+		if err != nil {
+			log.Printf("Failed to send email change notice for user %d: %v", userID, err)
+		}
+	}()
+
+	Audit(r, "email.change_requested", userID, userID, map[string]interface{}{"new_email": newEmail})
+	utils.JSON(w, http.StatusOK, map[string]string{"status": "verification_sent", "pending_email": newEmail})
+}
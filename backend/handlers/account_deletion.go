@@ -0,0 +1,364 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"social-network/backend/config"
+	"social-network/backend/db"
+	"social-network/backend/mailer"
+	"social-network/backend/utils"
+)
+
+// POST /api/account/delete - { password }
+// Schedules the account for deletion after the configured grace period and
+// signs out every session. Logging in again before then cancels the deletion.
+func DeleteAccountHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	uid := utils.GetUserIDFromContext(r)
+	if uid == "" {
+		utils.Error(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	userID, _ := strconv.ParseInt(uid, 10, 64)
+
+	var payload struct {
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.Password == "" {
+		utils.Error(w, http.StatusBadRequest, "Invalid input")
+		return
+	}
+	email, ok := checkCurrentPassword(userID, payload.Password)
+	if !ok {
+		utils.Error(w, http.StatusUnauthorized, "Password is incorrect")
+		return
+	}
+
+	deleteAfter := time.Now().Add(config.Current.AccountDeletionGrace)
+	if _, err := db.DB.Exec("UPDATE users SET deletion_scheduled_at = ?, online_status = 0 WHERE id = ?", deleteAfter, userID); err != nil {
+		log.Printf("Failed to schedule deletion for user %d: %v", userID, err)
+		utils.Error(w, http.StatusInternalServerError, "Failed to schedule account deletion")
+		return
+	}
+	if _, err := utils.RevokeUserSessions(userID, 0); err != nil {
+		log.Printf("Failed to revoke sessions for user %d: %v", userID, err)
+	}
+	db.DB.Exec("DELETE FROM personal_access_tokens WHERE user_id = ?", userID)
+	utils.ExpireSessionCookie(w)
+
+	go func() {
+		err := mailer.Send(mailer.Message{
+			To:      email,
+			Subject: "Your account is scheduled for deletion",
+			Body: fmt.Sprintf("Your account and all of its content will be permanently deleted on %s.\n\n"+
+				"Changed your mind? Just log in again before then and the deletion will be cancelled.",
+				deleteAfter.UTC().Format("2 January 2006 15:04 MST")),
+		})
+		if err != nil {
+			log.Printf("Failed to send deletion notice for user %d: %v", userID, err)
+		}
+	}()
+
+	Audit(r, "account.deletion_scheduled", userID, userID, map[string]interface{}{"delete_after": deleteAfter})
+	utils.JSON(w, http.StatusOK, map[string]interface{}{"status": "deletion_scheduled", "delete_after": deleteAfter})
+}
+
+// cancelAccountDeletion clears a pending deletion and reports whether there was one.
+func cancelAccountDeletion(userID int64) bool {
+	res, err := db.DB.Exec("UPDATE users SET deletion_scheduled_at = NULL WHERE id = ? AND deletion_scheduled_at IS NOT NULL", userID)
+	if err != nil {
+		log.Printf("Failed to cancel deletion for user %d: %v", userID, err)
+		return false
+	}
+	n, _ := res.RowsAffected()
+	return n > 0
+}
+
+// PurgeDeletedAccounts permanently removes every account whose grace period
+// has run out. It is run periodically from main.
+func PurgeDeletedAccounts() {
+	rows, err := db.DB.Query("SELECT id FROM users WHERE deletion_scheduled_at IS NOT NULL AND deletion_scheduled_at <= ?", time.Now())
+	if err != nil {
+		log.Println("Account purge query error:", err)
+		return
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if rows.Scan(&id) == nil {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		if err := purgeAccount(id); err != nil {
+			log.Printf("Failed to purge account %d: %v", id, err)
+			continue
+		}
+		log.Printf("Purged account %d", id)
+	}
+}
+
+// purgeAccount deletes a user and everything they own in one transaction.
+// Foreign keys can't be relied on here: followers, follow_requests and
+// notifications.actor_id have no ON DELETE CASCADE, and foreign key
+// enforcement is only switched on for one pooled connection, so every
+// dependent row is removed explicitly.
+func purgeAccount(userID int64) error {
+	files, err := collectUserUploads(userID)
+	if err != nil {
+		return err
+	}
+	var archives []string
+	if rows, err := db.DB.Query("SELECT file_path FROM data_exports WHERE user_id = ? AND file_path IS NOT NULL", userID); err == nil {
+		for rows.Next() {
+			var p string
+			if rows.Scan(&p) == nil {
+				archives = append(archives, p)
+			}
+		}
+		rows.Close()
+	}
+
+	// The user's tombstoned comments keep its id after the users row is
+	// gone, which enforced foreign keys would turn into deleting them, and
+	// the replies below them, too. The pragma only takes effect outside a
+	// transaction, so the purge runs on a connection of its own.
+	ctx := context.Background()
+	conn, err := db.DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF"); err != nil {
+		return err
+	}
+	defer conn.ExecContext(ctx, "PRAGMA foreign_keys = ON")
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// groups the user owns go to their longest-standing member, or are
+	// removed entirely when nobody else is left
+	type handover struct{ groupID, newOwner int64 }
+	var handovers []handover
+	var emptyGroups []int64
+	rows, err := tx.Query("SELECT id FROM groups WHERE owner_id = ?", userID)
+	if err != nil {
+		return err
+	}
+	var owned []int64
+	for rows.Next() {
+		var gid int64
+		if err := rows.Scan(&gid); err != nil {
+			rows.Close()
+			return err
+		}
+		owned = append(owned, gid)
+	}
+	rows.Close()
+	for _, gid := range owned {
+		var next int64
+		err := tx.QueryRow("SELECT user_id FROM group_members WHERE group_id = ? AND user_id != ? ORDER BY joined_at, id LIMIT 1", gid, userID).Scan(&next)
+		switch {
+		case err == sql.ErrNoRows:
+			emptyGroups = append(emptyGroups, gid)
+		case err != nil:
+			return err
+		default:
+			handovers = append(handovers, handover{gid, next})
+		}
+	}
+	for _, h := range handovers {
+		if _, err := tx.Exec("UPDATE groups SET owner_id = ? WHERE id = ?", h.newOwner, h.groupID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("UPDATE group_members SET role = 'owner' WHERE group_id = ? AND user_id = ?", h.groupID, h.newOwner); err != nil {
+			return err
+		}
+	}
+	for _, gid := range emptyGroups {
+		if err := deleteGroupTx(tx, gid); err != nil {
+			return err
+		}
+	}
+
+	stmts := []string{
+		// group content
+		"DELETE FROM event_votes WHERE user_id = ? OR event_id IN (SELECT id FROM events WHERE creator_id = ?1)",
+		"DELETE FROM events WHERE creator_id = ?",
+		"DELETE FROM reactions WHERE user_id = ?",
+		"DELETE FROM mentions WHERE user_id = ?",
+		`DELETE FROM comment_archive WHERE author_id = ?
+			OR (comment_type = 'comment' AND post_id IN (SELECT id FROM posts WHERE author_id = ?1))
+			OR (comment_type = 'group_comment' AND post_id IN (SELECT id FROM group_posts WHERE author_id = ?1))`,
+		userGroupCommentThreads + `DELETE FROM reactions WHERE (target_type = 'group_post' AND target_id IN (SELECT id FROM group_posts WHERE author_id = ?1))
+			OR (target_type = 'group_comment' AND (target_id IN (SELECT id FROM thread) OR target_id IN (SELECT id FROM group_comments WHERE user_id = ?1)))`,
+		userGroupCommentThreads + `DELETE FROM mentions WHERE (target_type = 'group_post' AND target_id IN (SELECT id FROM group_posts WHERE author_id = ?1))
+			OR (target_type = 'group_comment' AND (target_id IN (SELECT id FROM thread) OR target_id IN (SELECT id FROM group_comments WHERE user_id = ?1)))
+			OR (target_type = 'group_message' AND target_id IN (SELECT id FROM group_messages WHERE sender_id = ?1))`,
+		userGroupCommentThreads + "DELETE FROM group_comments WHERE id IN (SELECT id FROM thread)",
+		`UPDATE group_comments SET content = '', image_url = NULL, removed_at = CURRENT_TIMESTAMP, removed_by = ?1
+			WHERE user_id = ?1 AND removed_at IS NULL`,
+		"DELETE FROM group_posts WHERE author_id = ?",
+		"DELETE FROM group_messages WHERE sender_id = ?",
+		"DELETE FROM group_requests WHERE requester_id = ?",
+		"DELETE FROM group_invites WHERE inviter_id = ? OR invitee_id = ?1",
+		"DELETE FROM group_members WHERE user_id = ?",
+		// posts and comments
+		userCommentThreads + `DELETE FROM reactions WHERE (target_type = 'post' AND target_id IN (SELECT id FROM posts WHERE author_id = ?1))
+			OR (target_type = 'comment' AND (target_id IN (SELECT id FROM thread) OR target_id IN (SELECT id FROM comments WHERE user_id = ?1)))`,
+		userCommentThreads + `DELETE FROM mentions WHERE (target_type = 'post' AND target_id IN (SELECT id FROM posts WHERE author_id = ?1))
+			OR (target_type = 'comment' AND (target_id IN (SELECT id FROM thread) OR target_id IN (SELECT id FROM comments WHERE user_id = ?1)))`,
+		userCommentThreads + "DELETE FROM comments WHERE id IN (SELECT id FROM thread)",
+		`UPDATE comments SET content = '', image_url = NULL, removed_at = CURRENT_TIMESTAMP, removed_by = ?1
+			WHERE user_id = ?1 AND removed_at IS NULL`,
+		"DELETE FROM timelines WHERE user_id = ? OR author_id = ?1",
+		"DELETE FROM post_audience WHERE user_id = ? OR post_id IN (SELECT id FROM posts WHERE author_id = ?1)",
+		"DELETE FROM post_revisions WHERE post_id IN (SELECT id FROM posts WHERE author_id = ?)",
+		"DELETE FROM posts WHERE author_id = ?",
+		// social graph and messages
+		"DELETE FROM followers WHERE follower_id = ? OR followed_id = ?1",
+		"DELETE FROM follow_requests WHERE sender_id = ? OR receiver_id = ?1",
+		// direct messages stay in the other person's history, from a sender
+		// without a name, unless the other person is gone as well
+		orphanedMessages + "DELETE FROM mentions WHERE target_type = 'message' AND target_id IN (SELECT id FROM orphaned)",
+		orphanedMessages + "DELETE FROM messages WHERE id IN (SELECT id FROM orphaned)",
+		"DELETE FROM notifications WHERE recipient_id = ? OR actor_id = ?1",
+		// authentication state
+		"DELETE FROM refresh_tokens WHERE user_id = ?",
+		"DELETE FROM personal_access_tokens WHERE user_id = ?",
+		"DELETE FROM sessions WHERE user_id = ?",
+		"DELETE FROM password_resets WHERE user_id = ?",
+		"DELETE FROM email_verifications WHERE user_id = ?",
+		"DELETE FROM mfa_recovery_codes WHERE user_id = ?",
+		"DELETE FROM mfa_challenges WHERE user_id = ?",
+		"DELETE FROM data_exports WHERE user_id = ?",
+		"UPDATE invite_codes SET created_by = NULL, revoked_at = COALESCE(revoked_at, CURRENT_TIMESTAMP) WHERE created_by = ?",
+		"DELETE FROM users WHERE id = ?",
+	}
+	for _, q := range stmts {
+		if _, err := tx.Exec(q, userID); err != nil {
+			return fmt.Errorf("%s: %w", q, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	removeUnreferencedUploads(files)
+	for _, p := range archives {
+		os.Remove(p)
+	}
+	Audit(nil, "account.purge", userID, 0, nil)
+	for _, h := range handovers {
+		Audit(nil, "group.ownership_transfer", h.newOwner, 0, map[string]interface{}{
+			"group_id": h.groupID, "from": userID, "to": h.newOwner, "reason": "account_deleted",
+		})
+		Notify(h.newOwner, 0, "group_ownership_transferred", map[string]interface{}{"group_id": h.groupID})
+	}
+	return nil
+}
+
+// deleteGroupTx removes a group together with all of its content.
+func deleteGroupTx(tx *sql.Tx, groupID int64) error {
+	stmts := []string{
+		"DELETE FROM event_votes WHERE event_id IN (SELECT id FROM events WHERE group_id = ?)",
+		"DELETE FROM events WHERE group_id = ?",
+		`DELETE FROM reactions WHERE (target_type = 'group_post' AND target_id IN (SELECT id FROM group_posts WHERE group_id = ?1))
+			OR (target_type = 'group_comment' AND target_id IN (SELECT c.id FROM group_comments c JOIN group_posts p ON p.id = c.post_id WHERE p.group_id = ?1))`,
+		`DELETE FROM mentions WHERE (target_type = 'group_post' AND target_id IN (SELECT id FROM group_posts WHERE group_id = ?1))
+			OR (target_type = 'group_comment' AND target_id IN (SELECT c.id FROM group_comments c JOIN group_posts p ON p.id = c.post_id WHERE p.group_id = ?1))
+			OR (target_type = 'group_message' AND target_id IN (SELECT id FROM group_messages WHERE group_id = ?1))`,
+		"DELETE FROM comment_archive WHERE comment_type = 'group_comment' AND post_id IN (SELECT id FROM group_posts WHERE group_id = ?)",
+		"DELETE FROM group_comments WHERE post_id IN (SELECT id FROM group_posts WHERE group_id = ?)",
+		"DELETE FROM group_posts WHERE group_id = ?",
+		"DELETE FROM group_messages WHERE group_id = ?",
+		"DELETE FROM group_requests WHERE group_id = ?",
+		"DELETE FROM group_invites WHERE group_id = ?",
+		"DELETE FROM group_members WHERE group_id = ?",
+		"DELETE FROM groups WHERE id = ?",
+	}
+	for _, q := range stmts {
+		if _, err := tx.Exec(q, groupID); err != nil {
+			return fmt.Errorf("%s: %w", q, err)
+		}
+	}
+	return nil
+}
+
+// userCommentThreads and userGroupCommentThreads select (as thread) the
+// comments that go away with user ?1: those on their posts, and theirs with
+// no replies from anyone else below them. Their other comments are left as
+// tombstones, so other people's replies stay.
+const (
+	userCommentThreads = `WITH RECURSIVE below(root, id, user_id) AS (
+			SELECT id, id, user_id FROM comments WHERE user_id = ?1
+			UNION ALL SELECT b.root, c.id, c.user_id FROM comments c JOIN below b ON c.parent_id = b.id),
+		thread(id) AS (
+			SELECT id FROM comments WHERE post_id IN (SELECT id FROM posts WHERE author_id = ?1)
+			UNION SELECT root FROM below GROUP BY root HAVING MAX(user_id != ?1) = 0) `
+	userGroupCommentThreads = `WITH RECURSIVE below(root, id, user_id) AS (
+			SELECT id, id, user_id FROM group_comments WHERE user_id = ?1
+			UNION ALL SELECT b.root, c.id, c.user_id FROM group_comments c JOIN below b ON c.parent_id = b.id),
+		thread(id) AS (
+			SELECT id FROM group_comments WHERE post_id IN (SELECT id FROM group_posts WHERE author_id = ?1)
+			UNION SELECT root FROM below GROUP BY root HAVING MAX(user_id != ?1) = 0) `
+)
+
+// collectUserUploads lists the uploaded files that go away with the user: their
+// avatar and the images of their posts and comments, including comments left
+// by others on their posts or as replies to theirs, and everything in groups
+// that will be removed.
+func collectUserUploads(userID int64) ([]string, error) {
+	rows, err := db.DB.Query(userCommentThreads+`
+		SELECT avatar FROM users WHERE id = ?1
+		UNION SELECT image_url FROM posts WHERE author_id = ?1
+		UNION SELECT r.image_url FROM post_revisions r JOIN posts p ON p.id = r.post_id WHERE p.author_id = ?1
+		UNION SELECT image_url FROM comments WHERE user_id = ?1 OR id IN (SELECT id FROM thread)
+		UNION SELECT image_url FROM comment_archive WHERE author_id = ?1
+			OR (comment_type = 'comment' AND post_id IN (SELECT id FROM posts WHERE author_id = ?1))
+			OR (comment_type = 'group_comment' AND post_id IN (SELECT id FROM group_posts WHERE author_id = ?1))
+		UNION SELECT image_url FROM group_posts WHERE author_id = ?1
+			OR group_id IN (SELECT id FROM groups WHERE owner_id = ?1 AND NOT EXISTS (SELECT 1 FROM group_members m WHERE m.group_id = groups.id AND m.user_id != ?1))
+		UNION SELECT c.image_url FROM group_comments c JOIN group_posts p ON p.id = c.post_id
+			WHERE c.user_id = ?1 OR p.author_id = ?1
+			OR c.id IN (`+userGroupCommentThreads+`SELECT id FROM thread)
+			OR p.group_id IN (SELECT id FROM groups WHERE owner_id = ?1 AND NOT EXISTS (SELECT 1 FROM group_members m WHERE m.group_id = groups.id AND m.user_id != ?1))`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var u sql.NullString
+		if err := rows.Scan(&u); err != nil {
+			return nil, err
+		}
+		if u.String != "" {
+			out = append(out, u.String)
+		}
+	}
+	return out, rows.Err()
+}
+
+// orphanedMessages selects the user's direct messages that nobody else can
+// read any more: those with themselves and with accounts already removed.
+const orphanedMessages = `WITH orphaned(id) AS (
+	SELECT id FROM messages WHERE (sender_id = ?1 OR receiver_id = ?1)
+		AND NOT EXISTS (SELECT 1 FROM users WHERE id != ?1 AND id IN (sender_id, receiver_id))
+) `
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"social-network/backend/db"
+)
+
+func TestPurgeKeepsOtherUsersReplies(t *testing.T) {
+	setupVisibilityDB(t)
+	// the follower's comments on the author's post:
+	// 1 has a reply from the stranger (2), 3 has none, 4 only has the follower's own reply (5)
+	if _, err := db.DB.Exec(`INSERT INTO comments (id, post_id, user_id, parent_id, content) VALUES
+		(1, 1, 2, NULL, 'mine'), (2, 1, 4, 1, 'a reply'), (3, 1, 2, NULL, 'alone'),
+		(4, 1, 2, NULL, 'thread'), (5, 1, 2, 4, 'my own reply')`); err != nil {
+		t.Fatal(err)
+	}
+	if err := purgeAccount(follower); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := db.DB.Query("SELECT id, content, removed_at IS NOT NULL FROM comments ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	type comment struct {
+		id      int64
+		content string
+		removed bool
+	}
+	var got []comment
+	for rows.Next() {
+		var c comment
+		rows.Scan(&c.id, &c.content, &c.removed)
+		got = append(got, c)
+	}
+	want := []comment{{1, "", true}, {2, "a reply", false}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("comments after the purge = %+v, want %+v", got, want)
+	}
+}
+
+func TestPurgeKeepsOtherUsersMessages(t *testing.T) {
+	setupVisibilityDB(t)
+	// 3 is a note to self and 4 went to an account that is already gone
+	if _, err := db.DB.Exec(`INSERT INTO messages (id, sender_id, receiver_id, content) VALUES
+		(1, 2, 4, 'hi'), (2, 4, 2, 'hello'), (3, 2, 2, 'note'), (4, 2, 99, 'anyone?')`); err != nil {
+		t.Fatal(err)
+	}
+	if err := purgeAccount(follower); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	GetMessageHistory(rec, asUser(httptest.NewRequest(http.MethodGet, "/api/messages/history?user_id=2", nil), stranger))
+	var history []struct {
+		ID         int64  `json:"id"`
+		SenderName string `json:"sender_name"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&history); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"", "stranger"}
+	if len(history) != len(want) {
+		t.Fatalf("stranger's history with the purged user = %+v, want 2 messages", history)
+	}
+	for i, m := range history {
+		if m.SenderName != want[i] {
+			t.Errorf("message %d sender_name = %q, want %q", m.ID, m.SenderName, want[i])
+		}
+	}
+	var left int
+	db.DB.QueryRow("SELECT COUNT(1) FROM messages").Scan(&left)
+	if left != 2 {
+		t.Errorf("%d messages left, want only the 2 with the stranger", left)
+	}
+}
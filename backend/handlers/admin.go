@@ -0,0 +1,602 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"social-network/backend/bus"
+	"social-network/backend/config"
+	"social-network/backend/db"
+	"social-network/backend/utils"
+)
+
+// Global user roles, from least to most privileged.
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+var roleRank = map[string]int{RoleUser: 0, RoleModerator: 1, RoleAdmin: 2}
+
+// UserRole returns the user's global role, or "" if the user doesn't exist.
+func UserRole(userID int64) string {
+	var role sql.NullString
+	if err := db.DB.QueryRow("SELECT role FROM users WHERE id = ?", userID).Scan(&role); err != nil {
+		return ""
+	}
+	if !role.Valid || role.String == "" {
+		return RoleUser
+	}
+	return role.String
+}
+
+// HasRole reports whether the user's role is at least min.
+func HasRole(userID int64, min string) bool {
+	role := UserRole(userID)
+	return role != "" && roleRank[role] >= roleRank[min]
+}
+
+// BootstrapAdmins promotes users listed in config.AdminEmails to admin once
+// their email address is verified. It runs at startup and after every email
+// verification, so the first admin only has to register and verify.
+func BootstrapAdmins() {
+	emails := config.Current.AdminEmails
+	if len(emails) == 0 {
+		return
+	}
+	args := make([]interface{}, len(emails))
+	for i, e := range emails {
+		args[i] = e
+	}
+	rows, err := db.DB.Query(`SELECT id, IFNULL(role, 'user') FROM users
+		WHERE LOWER(email) IN (?`+strings.Repeat(", ?", len(emails)-1)+`) AND verified_at IS NOT NULL AND IFNULL(role, 'user') != 'admin'`, args...)
+	if err != nil {
+		log.Println("Admin bootstrap error:", err)
+		return
+	}
+	promote := map[int64]string{}
+	for rows.Next() {
+		var id int64
+		var role string
+		if rows.Scan(&id, &role) == nil {
+			promote[id] = role
+		}
+	}
+	rows.Close()
+	for id, role := range promote {
+		if _, err := db.DB.Exec("UPDATE users SET role = 'admin' WHERE id = ?", id); err != nil {
+			log.Printf("Admin bootstrap error for user %d: %v", id, err)
+			continue
+		}
+		log.Printf("Promoted user %d from ADMIN_EMAILS to admin", id)
+		Audit(nil, "role.change", id, 0, map[string]interface{}{"from": role, "to": RoleAdmin, "via": "ADMIN_EMAILS"})
+	}
+}
+
+// Suspension is a suspension currently in force. Until is nil for a permanent ban.
+type Suspension struct {
+	Reason string     `json:"reason"`
+	Until  *time.Time `json:"suspended_until,omitempty"`
+}
+
+// ActiveSuspension returns the user's suspension in force, or nil. Timed
+// suspensions that have run out are cleared on the way.
+func ActiveSuspension(userID int64) *Suspension {
+	var at, until sql.NullTime
+	var reason sql.NullString
+	if err := db.DB.QueryRow("SELECT suspended_at, suspended_until, suspension_reason FROM users WHERE id = ?", userID).
+		Scan(&at, &until, &reason); err != nil || !at.Valid {
+		return nil
+	}
+	if now := time.Now(); until.Valid && now.After(until.Time) {
+		db.DB.Exec(`UPDATE users SET suspended_at = NULL, suspended_until = NULL, suspended_by = NULL, suspension_reason = NULL
+			WHERE id = ? AND suspended_until < ?`, userID, now)
+		return nil
+	}
+	s := &Suspension{Reason: reason.String}
+	if until.Valid {
+		s.Until = &until.Time
+	}
+	return s
+}
+
+// WriteSuspended answers a request from a suspended user.
+func WriteSuspended(w http.ResponseWriter, s *Suspension) {
+	utils.JSON(w, http.StatusForbidden, map[string]interface{}{
+		"error":           "Account suspended",
+		"reason":          s.Reason,
+		"suspended_until": s.Until,
+		"permanent":       s.Until == nil,
+	})
+}
+
+// adminActor returns the calling moderator/admin's id and role.
+func adminActor(r *http.Request) (int64, string) {
+	id, _ := strconv.ParseInt(utils.GetUserIDFromContext(r), 10, 64)
+	return id, UserRole(id)
+}
+
+// canModerate reports whether actor may act on target: never on themselves,
+// and only on users ranked below them.
+func canModerate(actorID int64, actorRole string, targetID int64) (string, bool) {
+	targetRole := UserRole(targetID)
+	if targetRole == "" {
+		return "", false
+	}
+	if targetID == actorID || roleRank[targetRole] >= roleRank[actorRole] {
+		return targetRole, false
+	}
+	return targetRole, true
+}
+
+// GET /api/admin/users?q=&role=&suspended=true&limit=&offset=
+func AdminListUsersHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	q := r.URL.Query()
+	where := []string{"1 = 1"}
+	var args []interface{}
+	if search := strings.TrimSpace(q.Get("q")); search != "" {
+		like := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(search) + "%"
+		where = append(where, `(email LIKE ? ESCAPE '\' OR nickname LIKE ? ESCAPE '\' OR first_name LIKE ? ESCAPE '\' OR last_name LIKE ? ESCAPE '\')`)
+		args = append(args, like, like, like, like)
+	}
+	if role := q.Get("role"); role != "" {
+		if _, ok := roleRank[role]; !ok {
+			utils.Error(w, http.StatusBadRequest, "Unknown role")
+			return
+		}
+		where = append(where, "role = ?")
+		args = append(args, role)
+	}
+	if q.Get("suspended") == "true" {
+		where = append(where, "suspended_at IS NOT NULL AND (suspended_until IS NULL OR suspended_until > ?)")
+		args = append(args, time.Now())
+	}
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	offset, _ := strconv.Atoi(q.Get("offset"))
+	if offset < 0 {
+		offset = 0
+	}
+	cond := strings.Join(where, " AND ")
+
+	var total int
+	if err := db.DB.QueryRow("SELECT COUNT(1) FROM users WHERE "+cond, args...).Scan(&total); err != nil {
+		utils.Error(w, http.StatusInternalServerError, "Failed to query users")
+		return
+	}
+	rows, err := db.DB.Query(`SELECT id, email, nickname, first_name, last_name, avatar, role, profile_type,
+		verified_at, suspended_at, suspended_until, suspension_reason, deletion_scheduled_at, invite_id
+		FROM users WHERE `+cond+` ORDER BY id LIMIT ? OFFSET ?`, append(args, limit, offset)...)
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, "Failed to query users")
+		return
+	}
+	defer rows.Close()
+
+	users := []map[string]interface{}{}
+	for rows.Next() {
+		var id int64
+		var email, nickname, first, last string
+		var avatar, role, profileType, reason sql.NullString
+		var verified, suspended, until, deletion sql.NullTime
+		var inviteID sql.NullInt64
+		if err := rows.Scan(&id, &email, &nickname, &first, &last, &avatar, &role, &profileType,
+			&verified, &suspended, &until, &reason, &deletion, &inviteID); err != nil {
+			continue
+		}
+		// a timed suspension that has run out only gets cleared at the next request
+		active := suspended.Valid && (!until.Valid || time.Now().Before(until.Time))
+		u := map[string]interface{}{
+			"id":             id,
+			"email":          email,
+			"nickname":       nickname,
+			"first_name":     first,
+			"last_name":      last,
+			"avatar":         utils.AbsURL(r, avatar.String),
+			"role":           role.String,
+			"profile_type":   profileType.String,
+			"email_verified": verified.Valid,
+			"suspended":      active,
+		}
+		if active {
+			u["suspended_at"] = suspended.Time
+			u["suspension_reason"] = reason.String
+			u["suspended_until"] = nil
+			if until.Valid {
+				u["suspended_until"] = until.Time
+			}
+		}
+		if deletion.Valid {
+			u["deletion_scheduled_at"] = deletion.Time
+		}
+		if inviteID.Valid {
+			u["invite_id"] = inviteID.Int64
+		}
+		users = append(users, u)
+	}
+	utils.JSON(w, http.StatusOK, map[string]interface{}{"users": users, "total": total, "limit": limit, "offset": offset})
+}
+
+// POST /api/admin/users/role - { user_id, role } (admins only)
+func AdminSetRoleHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	actorID, _ := adminActor(r)
+	var payload struct {
+		UserID int64  `json:"user_id"`
+		Role   string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.UserID <= 0 {
+		utils.Error(w, http.StatusBadRequest, "Invalid input")
+		return
+	}
+	if _, ok := roleRank[payload.Role]; !ok {
+		utils.Error(w, http.StatusBadRequest, "Role must be user, moderator or admin")
+		return
+	}
+	current := UserRole(payload.UserID)
+	if current == "" {
+		utils.Error(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if payload.UserID == actorID && payload.Role != RoleAdmin {
+		// otherwise the last admin could lock everyone out of the admin API
+		utils.Error(w, http.StatusBadRequest, "You can't demote yourself")
+		return
+	}
+	// the count is part of the update, so two admins demoting each other
+	// can't both succeed
+	res, err := db.DB.Exec(`UPDATE users SET role = ?1 WHERE id = ?2
+		AND (role != 'admin' OR ?1 = 'admin' OR (SELECT COUNT(1) FROM users WHERE role = 'admin') > 1)`, payload.Role, payload.UserID)
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, "Failed to update role")
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		utils.Error(w, http.StatusConflict, "Can't demote the last admin")
+		return
+	}
+	if current != payload.Role {
+		Audit(r, "role.change", payload.UserID, actorID, map[string]interface{}{"from": current, "to": payload.Role})
+	}
+	utils.JSON(w, http.StatusOK, map[string]interface{}{"user_id": payload.UserID, "role": payload.Role})
+}
+
+// POST /api/admin/users/suspend - { user_id, reason, duration_hours }
+// A duration of 0 (or none) bans the account permanently. Suspended users are
+// signed out everywhere, their websocket is closed, and they can't log in or
+// use any token until the suspension ends.
+func AdminSuspendUserHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	actorID, actorRole := adminActor(r)
+	var payload struct {
+		UserID        int64  `json:"user_id"`
+		Reason        string `json:"reason"`
+		DurationHours int    `json:"duration_hours"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.UserID <= 0 || payload.DurationHours < 0 {
+		utils.Error(w, http.StatusBadRequest, "Invalid input")
+		return
+	}
+	reason := strings.TrimSpace(payload.Reason)
+	if reason == "" {
+		utils.Error(w, http.StatusBadRequest, "A reason is required")
+		return
+	}
+	if _, ok := canModerate(actorID, actorRole, payload.UserID); !ok {
+		utils.Error(w, http.StatusForbidden, "You can't suspend this user")
+		return
+	}
+	now := time.Now()
+	var until interface{}
+	var untilTime *time.Time
+	if payload.DurationHours > 0 {
+		t := now.Add(time.Duration(payload.DurationHours) * time.Hour)
+		until, untilTime = t, &t
+	}
+	if _, err := db.DB.Exec(`UPDATE users SET suspended_at = ?, suspended_until = ?, suspended_by = ?, suspension_reason = ?, online_status = 0
+		WHERE id = ?`, now, until, actorID, reason, payload.UserID); err != nil {
+		utils.Error(w, http.StatusInternalServerError, "Failed to suspend user")
+		return
+	}
+	revoked := forceLogout(payload.UserID)
+	Audit(r, "admin.suspend", payload.UserID, actorID, map[string]interface{}{
+		"reason": reason, "suspended_until": untilTime, "sessions_revoked": revoked,
+	})
+	utils.JSON(w, http.StatusOK, map[string]interface{}{
+		"status":           "suspended",
+		"suspended_until":  untilTime,
+		"permanent":        untilTime == nil,
+		"sessions_revoked": revoked,
+	})
+}
+
+// POST /api/admin/users/unsuspend - { user_id }
+func AdminUnsuspendUserHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	actorID, actorRole := adminActor(r)
+	var payload struct {
+		UserID int64 `json:"user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.UserID <= 0 {
+		utils.Error(w, http.StatusBadRequest, "Invalid input")
+		return
+	}
+	if _, ok := canModerate(actorID, actorRole, payload.UserID); !ok {
+		utils.Error(w, http.StatusForbidden, "You can't unsuspend this user")
+		return
+	}
+	if _, err := db.DB.Exec("UPDATE users SET suspended_at = NULL, suspended_until = NULL, suspended_by = NULL, suspension_reason = NULL WHERE id = ?", payload.UserID); err != nil {
+		utils.Error(w, http.StatusInternalServerError, "Failed to unsuspend user")
+		return
+	}
+	Audit(r, "admin.unsuspend", payload.UserID, actorID, nil)
+	utils.JSON(w, http.StatusOK, map[string]string{"status": "active"})
+}
+
+// POST /api/admin/users/logout - { user_id } sign the user out of every session
+func AdminForceLogoutHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	actorID, actorRole := adminActor(r)
+	var payload struct {
+		UserID int64 `json:"user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.UserID <= 0 {
+		utils.Error(w, http.StatusBadRequest, "Invalid input")
+		return
+	}
+	if _, ok := canModerate(actorID, actorRole, payload.UserID); !ok {
+		utils.Error(w, http.StatusForbidden, "You can't sign out this user")
+		return
+	}
+	revoked := forceLogout(payload.UserID)
+	Audit(r, "admin.force_logout", payload.UserID, actorID, map[string]interface{}{"sessions_revoked": revoked})
+	utils.JSON(w, http.StatusOK, map[string]interface{}{"status": "logged_out", "sessions_revoked": revoked})
+}
+
+// forceLogout wipes every session (and with them the refresh tokens) of a
+// user and drops their websocket connection.
+func forceLogout(userID int64) int64 {
+	defer bus.DisconnectUser(userID)
+	revoked, err := utils.RevokeUserSessions(userID, 0)
+	if err != nil {
+		log.Printf("Failed to revoke sessions for user %d: %v", userID, err)
+	}
+	db.DB.Exec("DELETE FROM refresh_tokens WHERE user_id = ?", userID)
+	db.DB.Exec("UPDATE users SET online_status = 0 WHERE id = ?", userID)
+	return revoked
+}
+
+// moderatedContent describes how to remove one kind of content.
+type moderatedContent struct {
+	ownerQuery string   // selects the author id of the item
+	images     string   // selects upload URLs that go away with it
+	deletes    []string // run in order, each with the item id
+	// comments is set for comments, which are left as tombstones instead
+	// when they have replies, so other people's replies stay.
+	comments *commentKind
+}
+
+var moderatedContentTypes = map[string]moderatedContent{
+	"post": {
+		ownerQuery: "SELECT author_id FROM posts WHERE id = ?",
+		images: `SELECT image_url FROM posts WHERE id = ?1 UNION SELECT image_url FROM comments WHERE post_id = ?1
+			UNION SELECT image_url FROM post_revisions WHERE post_id = ?1
+			UNION SELECT image_url FROM comment_archive WHERE comment_type = 'comment' AND post_id = ?1`,
+		deletes: []string{
+			"DELETE FROM reactions WHERE (target_type = 'post' AND target_id = ?1) OR (target_type = 'comment' AND target_id IN (SELECT id FROM comments WHERE post_id = ?1))",
+			"DELETE FROM mentions WHERE (target_type = 'post' AND target_id = ?1) OR (target_type = 'comment' AND target_id IN (SELECT id FROM comments WHERE post_id = ?1))",
+			"DELETE FROM comment_archive WHERE comment_type = 'comment' AND post_id = ?",
+			"DELETE FROM comments WHERE post_id = ?",
+			"DELETE FROM post_audience WHERE post_id = ?",
+			"DELETE FROM timelines WHERE post_id = ?",
+			"DELETE FROM post_revisions WHERE post_id = ?",
+			"DELETE FROM posts WHERE id = ?",
+		},
+	},
+	"comment": {
+		ownerQuery: "SELECT user_id FROM comments WHERE id = ?",
+		images:     "SELECT image_url FROM comments WHERE id = ?",
+		deletes: []string{
+			"DELETE FROM reactions WHERE target_type = 'comment' AND target_id = ?",
+			"DELETE FROM mentions WHERE target_type = 'comment' AND target_id = ?",
+			"DELETE FROM comments WHERE id = ?",
+		},
+		comments: &postCommentKind,
+	},
+	"group_post": {
+		ownerQuery: "SELECT author_id FROM group_posts WHERE id = ?",
+		images: `SELECT image_url FROM group_posts WHERE id = ?1 UNION SELECT image_url FROM group_comments WHERE post_id = ?1
+			UNION SELECT image_url FROM comment_archive WHERE comment_type = 'group_comment' AND post_id = ?1`,
+		deletes: []string{
+			"DELETE FROM reactions WHERE (target_type = 'group_post' AND target_id = ?1) OR (target_type = 'group_comment' AND target_id IN (SELECT id FROM group_comments WHERE post_id = ?1))",
+			"DELETE FROM mentions WHERE (target_type = 'group_post' AND target_id = ?1) OR (target_type = 'group_comment' AND target_id IN (SELECT id FROM group_comments WHERE post_id = ?1))",
+			"DELETE FROM comment_archive WHERE comment_type = 'group_comment' AND post_id = ?",
+			"DELETE FROM group_comments WHERE post_id = ?",
+			"DELETE FROM group_posts WHERE id = ?",
+		},
+	},
+	"group_comment": {
+		ownerQuery: "SELECT user_id FROM group_comments WHERE id = ?",
+		images:     "SELECT image_url FROM group_comments WHERE id = ?",
+		deletes: []string{
+			"DELETE FROM reactions WHERE target_type = 'group_comment' AND target_id = ?",
+			"DELETE FROM mentions WHERE target_type = 'group_comment' AND target_id = ?",
+			"DELETE FROM group_comments WHERE id = ?",
+		},
+		comments: &groupCommentKind,
+	},
+	"group_message": {
+		ownerQuery: "SELECT sender_id FROM group_messages WHERE id = ?",
+		deletes:    []string{"DELETE FROM mentions WHERE target_type = 'group_message' AND target_id = ?", "DELETE FROM group_messages WHERE id = ?"},
+	},
+	"message": {
+		ownerQuery: "SELECT sender_id FROM messages WHERE id = ?",
+		deletes:    []string{"DELETE FROM mentions WHERE target_type = 'message' AND target_id = ?", "DELETE FROM messages WHERE id = ?"},
+	},
+	"event": {
+		ownerQuery: "SELECT creator_id FROM events WHERE id = ?",
+		deletes:    []string{"DELETE FROM event_votes WHERE event_id = ?", "DELETE FROM events WHERE id = ?"},
+	},
+}
+
+// removeContent deletes an item with everything attached to it, then the
+// uploaded files nothing else uses any more.
+func removeContent(kind moderatedContent, id int64) error {
+	var images []string
+	if kind.images != "" {
+		if rows, err := db.DB.Query(kind.images, id); err == nil {
+			for rows.Next() {
+				var u sql.NullString
+				if rows.Scan(&u) == nil && u.String != "" {
+					images = append(images, u.String)
+				}
+			}
+			rows.Close()
+		}
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, q := range kind.deletes {
+		if _, err := tx.Exec(q, id); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	removeUnreferencedUploads(images)
+	return nil
+}
+
+// POST /api/admin/content/delete - { type, id, reason }
+// type is one of post, comment, group_post, group_comment, group_message, message or event.
+// The author is notified with the reason.
+func AdminDeleteContentHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	actorID, actorRole := adminActor(r)
+	var payload struct {
+		Type   string `json:"type"`
+		ID     int64  `json:"id"`
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.ID <= 0 {
+		utils.Error(w, http.StatusBadRequest, "Invalid input")
+		return
+	}
+	kind, ok := moderatedContentTypes[payload.Type]
+	if !ok {
+		utils.Error(w, http.StatusBadRequest, "Unknown content type")
+		return
+	}
+
+	var ownerID int64
+	if err := db.DB.QueryRow(kind.ownerQuery, payload.ID).Scan(&ownerID); err != nil {
+		utils.Error(w, http.StatusNotFound, "Content not found")
+		return
+	}
+	// moderators may remove their own content, but not that of their peers or superiors
+	if _, ok := canModerate(actorID, actorRole, ownerID); !ok && ownerID != actorID {
+		utils.Error(w, http.StatusForbidden, "You can't delete this user's content")
+		return
+	}
+	var err error
+	if kind.comments != nil && commentReplies(*kind.comments, payload.ID) > 0 {
+		var c *storedComment
+		if c, err = loadStoredComment(*kind.comments, payload.ID); err == nil {
+			err = tombstoneComment(*kind.comments, c, actorID)
+		}
+	} else {
+		err = removeContent(kind, payload.ID)
+	}
+	if err != nil {
+		log.Printf("Content delete error (%s %d): %v", payload.Type, payload.ID, err)
+		utils.Error(w, http.StatusInternalServerError, "Failed to delete content")
+		return
+	}
+
+	Audit(r, "admin.delete_content", ownerID, actorID, map[string]interface{}{
+		"content_type": payload.Type, "content_id": payload.ID, "reason": strings.TrimSpace(payload.Reason),
+	})
+	if ownerID != actorID {
+		Notify(ownerID, 0, "content_removed", map[string]interface{}{
+			"content_type": payload.Type,
+			"content_id":   payload.ID,
+			"reason":       strings.TrimSpace(payload.Reason),
+		})
+	}
+	utils.JSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+// GET /api/admin/stats - counts for the admin dashboard
+func AdminStatsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	now := time.Now()
+	counts := []struct {
+		key   string
+		query string
+		args  []interface{}
+	}{
+		{"users", "SELECT COUNT(1) FROM users", nil},
+		{"users_unverified", "SELECT COUNT(1) FROM users WHERE verified_at IS NULL", nil},
+		{"users_suspended", "SELECT COUNT(1) FROM users WHERE suspended_at IS NOT NULL AND (suspended_until IS NULL OR suspended_until > ?)", []interface{}{now}},
+		{"users_banned", "SELECT COUNT(1) FROM users WHERE suspended_at IS NOT NULL AND suspended_until IS NULL", nil},
+		{"users_pending_deletion", "SELECT COUNT(1) FROM users WHERE deletion_scheduled_at IS NOT NULL", nil},
+		{"moderators", "SELECT COUNT(1) FROM users WHERE role = 'moderator'", nil},
+		{"admins", "SELECT COUNT(1) FROM users WHERE role = 'admin'", nil},
+		{"users_online", "SELECT COUNT(1) FROM users WHERE online_status = 1", nil},
+		{"active_sessions", "SELECT COUNT(1) FROM sessions WHERE expiry > ?", []interface{}{now}},
+		{"active_users_24h", "SELECT COUNT(DISTINCT user_id) FROM sessions WHERE last_seen_at > ?", []interface{}{now.Add(-24 * time.Hour)}},
+		{"posts", "SELECT COUNT(1) FROM posts", nil},
+		{"posts_24h", "SELECT COUNT(1) FROM posts WHERE created_at > ?", []interface{}{now.Add(-24 * time.Hour).UTC().Format("2006-01-02 15:04:05")}},
+		{"comments", "SELECT COUNT(1) FROM comments", nil},
+		{"groups", "SELECT COUNT(1) FROM groups", nil},
+		{"group_posts", "SELECT COUNT(1) FROM group_posts", nil},
+		{"events", "SELECT COUNT(1) FROM events", nil},
+		{"messages", "SELECT COUNT(1) FROM messages", nil},
+		{"group_messages", "SELECT COUNT(1) FROM group_messages", nil},
+	}
+	out := make(map[string]int64, len(counts))
+	for _, c := range counts {
+		var n int64
+		if err := db.DB.QueryRow(c.query, c.args...).Scan(&n); err != nil {
+			log.Printf("Stats query %s failed: %v", c.key, err)
+			continue
+		}
+		out[c.key] = n
+	}
+	utils.JSON(w, http.StatusOK, out)
+}
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"social-network/backend/db"
+)
+
+func TestAdminsCantDemoteEachOtherAway(t *testing.T) {
+	setupVisibilityDB(t)
+	if _, err := db.DB.Exec("UPDATE users SET role = 'admin' WHERE id IN (?, ?)", author, follower); err != nil {
+		t.Fatal(err)
+	}
+	demote := func(actor, target int64) int {
+		rec := httptest.NewRecorder()
+		body := fmt.Sprintf(`{"user_id": %d, "role": "user"}`, target)
+		AdminSetRoleHandler(rec, asUser(httptest.NewRequest(http.MethodPost, "/api/admin/users/role", strings.NewReader(body)), actor))
+		return rec.Code
+	}
+	if code := demote(author, follower); code != http.StatusOK {
+		t.Fatalf("demoting the other admin: status %d", code)
+	}
+	// as if the follower's request had been let through before the first landed
+	if code := demote(follower, author); code != http.StatusConflict {
+		t.Fatalf("demoting the last admin: status %d, want %d", code, http.StatusConflict)
+	}
+	if role := UserRole(author); role != RoleAdmin {
+		t.Errorf("last admin's role = %q", role)
+	}
+}
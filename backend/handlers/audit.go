@@ -0,0 +1,236 @@
+package handlers
+
+// Security audit log. Entries are only ever appended (triggers on audit_log
+// refuse updates and deletes) and form a hash chain: every entry's hash
+// covers its content and the previous entry's hash, so altering or removing
+// a row is caught by VerifyAuditChain.
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"social-network/backend/db"
+	"social-network/backend/models"
+	"social-network/backend/utils"
+)
+
+// auditTimeFormat is fixed-width so timestamps sort and compare as text.
+const auditTimeFormat = "2006-01-02T15:04:05.000000Z"
+
+// auditMu makes reading the chain head and appending to it atomic.
+var auditMu sync.Mutex
+
+// Audit appends an entry to the security audit log. userID is whose history
+// it belongs to and actorID who did it (0 for the system); r supplies the IP
+// and user agent and may be nil for background jobs. Failures are logged but
+// never fail the request.
+func Audit(r *http.Request, action string, userID, actorID int64, data map[string]interface{}) {
+	var ip, ua string
+	if r != nil {
+		ip = utils.ClientIP(r)
+		ua = r.UserAgent()
+		if len(ua) > 512 {
+			ua = ua[:512]
+		}
+	}
+	var details string
+	if len(data) > 0 {
+		raw, _ := json.Marshal(data)
+		details = string(raw)
+	}
+
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	var prev string
+	if err := db.DB.QueryRow("SELECT hash FROM audit_log ORDER BY id DESC LIMIT 1").Scan(&prev); err != nil && err != sql.ErrNoRows {
+		log.Printf("Audit log error (%s): %v", action, err)
+		return
+	}
+	createdAt := time.Now().UTC().Format(auditTimeFormat)
+	hash := auditHash(prev, userID, actorID, action, ip, ua, details, createdAt)
+	_, err := db.DB.Exec(`INSERT INTO audit_log (user_id, actor_id, action, ip_address, user_agent, data, created_at, prev_hash, hash)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		auditID(userID), auditID(actorID), action, ip, ua, details, createdAt, prev, hash)
+	if err != nil {
+		log.Printf("Audit log error (%s): %v", action, err)
+	}
+}
+
+func auditID(id int64) interface{} {
+	if id <= 0 {
+		return nil
+	}
+	return id
+}
+
+func auditHash(prev string, userID, actorID int64, action, ip, ua, data, createdAt string) string {
+	// a JSON array keeps field boundaries unambiguous
+	canonical, _ := json.Marshal([]interface{}{prev, userID, actorID, action, ip, ua, data, createdAt})
+	sum := sha256.Sum256(canonical)
+	return hex.EncodeToString(sum[:])
+}
+
+// VerifyAuditChain recomputes the whole chain. It returns the number of
+// entries checked, the id of the first entry that doesn't match (0 if none)
+// and the hash of the last entry.
+func VerifyAuditChain() (checked int, brokenAt int64, head string, err error) {
+	rows, err := db.DB.Query(`SELECT id, IFNULL(user_id, 0), IFNULL(actor_id, 0), action, IFNULL(ip_address, ''),
+		IFNULL(user_agent, ''), IFNULL(data, ''), created_at, prev_hash, hash FROM audit_log ORDER BY id`)
+	if err != nil {
+		return 0, 0, "", err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, userID, actorID int64
+		var action, ip, ua, data, createdAt, prev, hash string
+		if err := rows.Scan(&id, &userID, &actorID, &action, &ip, &ua, &data, &createdAt, &prev, &hash); err != nil {
+			return checked, 0, head, err
+		}
+		checked++
+		if prev != head || hash != auditHash(prev, userID, actorID, action, ip, ua, data, createdAt) {
+			return checked, id, head, nil
+		}
+		head = hash
+	}
+	return checked, 0, head, rows.Err()
+}
+
+// GET /api/audit?action=&before=&limit= - the current user's security history
+func AuditLogHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	uid := utils.GetUserIDFromContext(r)
+	if uid == "" {
+		utils.Error(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	userID, _ := strconv.ParseInt(uid, 10, 64)
+	queryAuditLog(w, r, []string{"user_id = ?"}, []interface{}{userID})
+}
+
+// GET /api/admin/audit?user_id=&actor_id=&action=&ip=&since=&until=&before=&limit=
+// action may end in "*" to match a prefix (e.g. "admin.*"); since and until are RFC 3339 times.
+// Admins see every entry, moderators only the comment moderation ones (comment.*).
+func AdminAuditLogHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	q := r.URL.Query()
+	var where []string
+	var args []interface{}
+	if _, role := adminActor(r); role != RoleAdmin {
+		where = append(where, "action LIKE 'comment.%'")
+	}
+	for _, f := range []string{"user_id", "actor_id"} {
+		if v := q.Get(f); v != "" {
+			id, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				utils.Error(w, http.StatusBadRequest, "Invalid "+f)
+				return
+			}
+			where = append(where, f+" = ?")
+			args = append(args, id)
+		}
+	}
+	if ip := q.Get("ip"); ip != "" {
+		where = append(where, "ip_address = ?")
+		args = append(args, ip)
+	}
+	for _, f := range []struct{ param, cond string }{{"since", "created_at >= ?"}, {"until", "created_at < ?"}} {
+		if v := q.Get(f.param); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				utils.Error(w, http.StatusBadRequest, "Invalid "+f.param+", expected an RFC 3339 time")
+				return
+			}
+			where = append(where, f.cond)
+			args = append(args, t.UTC().Format(auditTimeFormat))
+		}
+	}
+	queryAuditLog(w, r, where, args)
+}
+
+// queryAuditLog lists entries matching where, newest first, applying the
+// shared action, before and limit parameters.
+func queryAuditLog(w http.ResponseWriter, r *http.Request, where []string, args []interface{}) {
+	q := r.URL.Query()
+	if action := q.Get("action"); action != "" {
+		if strings.HasSuffix(action, "*") {
+			where = append(where, "action LIKE ? ESCAPE '\\'")
+			args = append(args, strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(strings.TrimSuffix(action, "*"))+"%")
+		} else {
+			where = append(where, "action = ?")
+			args = append(args, action)
+		}
+	}
+	if before, _ := strconv.ParseInt(q.Get("before"), 10, 64); before > 0 {
+		where = append(where, "id < ?")
+		args = append(args, before)
+	}
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	cond := "1 = 1"
+	if len(where) > 0 {
+		cond = strings.Join(where, " AND ")
+	}
+	rows, err := db.DB.Query(`SELECT id, IFNULL(user_id, 0), IFNULL(actor_id, 0), action, IFNULL(ip_address, ''),
+		IFNULL(user_agent, ''), IFNULL(data, ''), created_at, hash
+		FROM audit_log WHERE `+cond+` ORDER BY id DESC LIMIT ?`, append(args, limit)...)
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, "Failed to query audit log")
+		return
+	}
+	defer rows.Close()
+
+	entries := []models.AuditEntry{}
+	for rows.Next() {
+		var e models.AuditEntry
+		var data string
+		if err := rows.Scan(&e.ID, &e.UserID, &e.ActorID, &e.Action, &e.IPAddress, &e.UserAgent, &data, &e.CreatedAt, &e.Hash); err != nil {
+			continue
+		}
+		if data != "" {
+			e.Data = json.RawMessage(data)
+		}
+		entries = append(entries, e)
+	}
+	resp := map[string]interface{}{"entries": entries}
+	if len(entries) == limit {
+		resp["next_before"] = entries[len(entries)-1].ID
+	}
+	utils.JSON(w, http.StatusOK, resp)
+}
+
+// GET /api/admin/audit/verify - recompute the hash chain (admins only)
+// Keep the returned head hash somewhere else: the chain can't show entries
+// cut off its end, but a stored head that no longer appears can.
+func AdminVerifyAuditHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	checked, brokenAt, head, err := VerifyAuditChain()
+	if err != nil {
+		log.Println("Audit chain verification error:", err)
+		utils.Error(w, http.StatusInternalServerError, "Failed to verify audit log")
+		return
+	}
+	resp := map[string]interface{}{"valid": brokenAt == 0, "entries": checked, "head": head}
+	if brokenAt != 0 {
+		resp["broken_at"] = brokenAt
+	}
+	utils.JSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"testing"
+
+	"social-network/backend/db"
+)
+
+func TestVerifyAuditChainFindsTampering(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string // run against the second entry, if any
+		broken int    // the first entry that no longer verifies, -1 for none
+	}{
+		{"intact", "", -1},
+		// an edit breaks the entry's own hash, a deletion the next one's link
+		{"edited entry", "UPDATE audit_log SET actor_id = 1 WHERE id = ?", 1},
+		{"deleted entry", "DELETE FROM audit_log WHERE id = ?", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupVisibilityDB(t)
+			for _, action := range []string{"login", "password.change", "logout"} {
+				Audit(nil, action, follower, follower, map[string]interface{}{"via": "test"})
+			}
+			var ids []int64
+			rows, err := db.DB.Query("SELECT id FROM audit_log ORDER BY id")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for rows.Next() {
+				var id int64
+				rows.Scan(&id)
+				ids = append(ids, id)
+			}
+			rows.Close()
+			if len(ids) != 3 {
+				t.Fatalf("%d audit entries written, want 3", len(ids))
+			}
+
+			if tt.query != "" {
+				// whoever tampers with the file directly isn't stopped by the triggers
+				if _, err := db.DB.Exec("DROP TRIGGER audit_log_no_update; DROP TRIGGER audit_log_no_delete"); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := db.DB.Exec(tt.query, ids[1]); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want := int64(0)
+			if tt.broken >= 0 {
+				want = ids[tt.broken]
+			}
+			_, brokenAt, _, err := VerifyAuditChain()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if brokenAt != want {
+				t.Errorf("chain broken at %d, want %d", brokenAt, want)
+			}
+		})
+	}
+}
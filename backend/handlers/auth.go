@@ -10,11 +10,12 @@ import (
 	"strings"
 	"time"
 
+	"social-network/backend/config"
 	"social-network/backend/db"
 	"social-network/backend/models"
+	"social-network/backend/ratelimit"
 	"social-network/backend/utils"
 
-	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -103,13 +104,24 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Apply the registration mode last, so a failed sign-up doesn't use up an invite
+	inviteID, ok := checkRegistration(w, req.Email, req.InviteCode)
+	if !ok {
+		return
+	}
+	var invite interface{}
+	if inviteID > 0 {
+		invite = inviteID
+	}
+
 	result, err := db.DB.Exec(`
-		INSERT INTO users (email, password, first_name, last_name, date_of_birth, avatar, nickname, about_me, profile_type)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		INSERT INTO users (email, password, first_name, last_name, date_of_birth, avatar, nickname, about_me, profile_type, invite_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		strings.ToLower(req.Email), hashedPassword, req.FirstName, req.LastName, req.DateOfBirth,
-		req.Avatar, req.Nickname, req.About, req.ProfileType,
+		req.Avatar, req.Nickname, req.About, req.ProfileType, invite,
 	)
 	if err != nil {
+		releaseInvite(inviteID)
 		// Detailed log for debugging
 		log.Printf("User creation error: %v; params: email=%s, nickname=%s, dob=%s", err, req.Email, req.Nickname, req.DateOfBirth)
 		// return generic message to client
@@ -126,14 +138,16 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("User registered successfully with ID: %d", userID)
 
+	// Send the email verification link; the account stays restricted until it is confirmed
+	email := strings.ToLower(req.Email)
+	go func() {
+		if err := SendVerificationEmail(userID, email); err != nil {
+			log.Printf("Failed to send verification email for user %d: %v", userID, err)
+		}
+	}()
+
 	// Create session for the newly registered user (auto-login)
-	sessionToken := uuid.New().String()
-	expiry := time.Now().Add(24 * time.Hour)
-	_, err = db.DB.Exec(
-		`INSERT INTO sessions (user_id, cookie_token, expiry) VALUES (?, ?, ?)`,
-		userID, sessionToken, expiry,
-	)
-	if err != nil {
+	if _, err := utils.CreateSession(w, r, userID); err != nil {
 		log.Printf("Session creation error after registration: %v", err)
 		// still return success for user creation, but log session error
 		w.Header().Set("Content-Type", "application/json")
@@ -141,17 +155,6 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Send cookie to browser
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session_token",
-		Value:    sessionToken,
-		Path:     "/",
-		Expires:  expiry,
-		HttpOnly: true,
-		Secure:   r.TLS != nil,
-		SameSite: http.SameSiteStrictMode,
-	})
-
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"message": "Registration successful", "user_id": strconv.FormatInt(userID, 10)})
 }
@@ -168,62 +171,100 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	userID, ok := checkLoginCredentials(w, r, req.Identifier, req.Password)
+	if !ok {
+		return
+	}
+
+	// Accounts with 2FA get a short-lived challenge instead of a session
+	if requireSecondFactor(w, userID) {
+		return
+	}
+
+	finishLogin(w, r, userID)
+}
+
+// checkLoginCredentials verifies an identifier (email or nickname) and
+// password, recording failures for the progressive lockout. On failure it has
+// already written the error response.
+func checkLoginCredentials(w http.ResponseWriter, r *http.Request, identifier, password string) (int64, bool) {
 	var userID int64
 	var hashedPassword string
-	err = db.DB.QueryRow(`
+	err := db.DB.QueryRow(`
 		SELECT id, password FROM users WHERE email = ? OR nickname = ?`,
-		req.Identifier, req.Identifier).Scan(&userID, &hashedPassword)
+		identifier, identifier).Scan(&userID, &hashedPassword)
 
 	if err == sql.ErrNoRows {
+		// count unknown identifiers too, so lockouts don't reveal which accounts exist
+		ratelimit.Default().Fail(ratelimit.LockoutKey(identifier, utils.ClientIP(r)))
+		Audit(r, "login.failure", 0, 0, map[string]interface{}{"identifier": identifier, "reason": "unknown_user"})
 		http.Error(w, `{"error":"Invalid credentials"}`, http.StatusUnauthorized)
-		return
+		return 0, false
 	} else if err != nil {
 		log.Printf("Login query error: %v", err)
 		http.Error(w, `{"error":"Server error"}`, http.StatusInternalServerError)
-		return
+		return 0, false
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(req.Password)); err != nil {
+	if err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password)); err != nil {
+		if lock := ratelimit.Default().Fail(ratelimit.LockoutKey(identifier, utils.ClientIP(r))); lock > 0 {
+			log.Printf("Login for %q from %s locked for %s after repeated failures", identifier, utils.ClientIP(r), lock)
+		}
+		Audit(r, "login.failure", userID, userID, map[string]interface{}{"identifier": identifier, "reason": "password"})
 		http.Error(w, `{"error":"Invalid credentials"}`, http.StatusUnauthorized)
-		return
+		return 0, false
 	}
+	ratelimit.Default().Reset(ratelimit.LockoutKey(identifier, utils.ClientIP(r)))
 
-	// Clear old sessions for this user
-	_, _ = db.DB.Exec("DELETE FROM sessions WHERE user_id = ?", userID)
+	if s := ActiveSuspension(userID); s != nil {
+		Audit(r, "login.failure", userID, userID, map[string]interface{}{"identifier": identifier, "reason": "suspended"})
+		WriteSuspended(w, s)
+		return 0, false
+	}
+	return userID, true
+}
 
-	// Create new session
-	sessionToken := uuid.New().String()
-	expiry := time.Now().Add(24 * time.Hour)
-	_, err = db.DB.Exec(
-		`INSERT INTO sessions (user_id, cookie_token, expiry) VALUES (?, ?, ?)`,
-		userID, sessionToken, expiry,
-	)
+// requireSecondFactor answers with an MFA challenge when the user has 2FA
+// enabled and reports whether it did so.
+func requireSecondFactor(w http.ResponseWriter, userID int64) bool {
+	if _, enabled, err := loadTOTP(userID); err != nil || !enabled {
+		return false
+	}
+	challenge, err := issueMFAChallenge(userID)
 	if err != nil {
+		log.Printf("MFA challenge creation error: %v", err)
+		http.Error(w, `{"error":"Server error"}`, http.StatusInternalServerError)
+		return true
+	}
+	utils.JSON(w, http.StatusOK, models.LoginResponse{
+		MFARequired:  true,
+		MFAChallenge: challenge,
+		ExpiresIn:    int(config.Current.MFAChallengeTTL.Seconds()),
+	})
+	return true
+}
+
+// finishLogin creates a session for a fully authenticated user and writes the login response.
+func finishLogin(w http.ResponseWriter, r *http.Request, userID int64) {
+	// Create new session; sessions on the user's other devices stay valid
+	if _, err := utils.CreateSession(w, r, userID); err != nil {
 		log.Printf("Session creation error: %v", err)
 		http.Error(w, `{"error":"Server error"}`, http.StatusInternalServerError)
 		return
 	}
 
 	// Set user online status
-	_, err = db.DB.Exec("UPDATE users SET online_status = 1 WHERE id = ?", userID)
-	if err != nil {
+	if _, err := db.DB.Exec("UPDATE users SET online_status = 1 WHERE id = ?", userID); err != nil {
 		log.Printf("Failed to update online status for user %d: %v", userID, err)
 		// Non-fatal error, so we don't abort the login
 	}
 
-	// Send cookie to browser
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session_token",
-		Value:    sessionToken,
-		Path:     "/",
-		Expires:  expiry,
-		HttpOnly: true,
-		Secure:   r.TLS != nil, // only secure in HTTPS
-		SameSite: http.SameSiteStrictMode,
-	})
+	// logging in during the grace period calls off a scheduled account deletion
+	cancelled := cancelAccountDeletion(userID)
+	Audit(r, "login.success", userID, userID, map[string]interface{}{"method": "session", "deletion_cancelled": cancelled})
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(models.LoginResponse{UserID: strconv.FormatInt(userID, 10)})
+	json.NewEncoder(w).Encode(models.LoginResponse{UserID: strconv.FormatInt(userID, 10), DeletionCancelled: cancelled})
 }
 
 func LogoutHandler(w http.ResponseWriter, r *http.Request) {
@@ -238,6 +279,7 @@ func LogoutHandler(w http.ResponseWriter, r *http.Request) {
 
 		// Update online status if user ID was found
 		if err == nil {
+			Audit(r, "logout", userID, userID, nil)
 			_, err = db.DB.Exec("UPDATE users SET online_status = 0 WHERE id = ?", userID)
 			if err != nil {
 				log.Printf("Failed to update online status on logout for user %d: %v", userID, err)
@@ -281,7 +323,11 @@ func CheckSessionHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	resp := map[string]string{"user_id": strconv.FormatInt(userIDInt, 10)}
+	resp := map[string]string{
+		"user_id":        strconv.FormatInt(userIDInt, 10),
+		"email_verified": strconv.FormatBool(IsEmailVerified(userIDInt)),
+		"role":           UserRole(userIDInt),
+	}
 	if nickname.Valid {
 		resp["nickname"] = nickname.String
 	}
@@ -294,8 +340,13 @@ func CheckSessionHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func CleanupSessions() {
-	_, err := db.DB.Exec("DELETE FROM sessions WHERE expiry < ?", time.Now())
+	now := time.Now()
+	_, err := db.DB.Exec("DELETE FROM sessions WHERE expiry < ?", now)
 	if err != nil {
 		log.Printf("Session cleanup error: %v", err)
 	}
+	_, err = db.DB.Exec("DELETE FROM refresh_tokens WHERE expires_at < ? OR session_id NOT IN (SELECT id FROM sessions)", now)
+	if err != nil {
+		log.Printf("Refresh token cleanup error: %v", err)
+	}
 }
@@ -83,9 +83,9 @@ func GetMessageHistory(w http.ResponseWriter, r *http.Request) {
 	// CRITICAL: Must use DESC order for pagination to work correctly
 	// Frontend will reverse for display
 	rows, err := db.DB.Query(`
-		SELECT m.id, m.sender_id, u.nickname, m.receiver_id, m.content, m.created_at
+		SELECT m.id, m.sender_id, IFNULL(u.nickname, ''), m.receiver_id, m.content, m.created_at
 		FROM messages m
-		JOIN users u ON m.sender_id = u.id
+		LEFT JOIN users u ON m.sender_id = u.id
 		WHERE (m.sender_id = ? AND m.receiver_id = ?) 
 			OR (m.sender_id = ? AND m.receiver_id = ?)
 		ORDER BY m.created_at DESC, m.id DESC
@@ -119,5 +119,14 @@ func GetMessageHistory(w http.ResponseWriter, r *http.Request) {
 		messages[i], messages[j] = messages[j], messages[i]
 	}
 
+	ids := make([]int64, len(messages))
+	for i := range messages {
+		ids[i] = int64(messages[i].ID)
+	}
+	mentions := loadMentions("message", ids)
+	for i := range messages {
+		messages[i].Mentions = mentions[ids[i]]
+	}
+
 	json.NewEncoder(w).Encode(messages)
 }
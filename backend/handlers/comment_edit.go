@@ -0,0 +1,327 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"social-network/backend/db"
+	"social-network/backend/utils"
+)
+
+// removedCommentText replaces the content of a removed comment in responses.
+const removedCommentText = "comment removed"
+
+// commentKind describes one of the two comment tables.
+type commentKind struct {
+	table        string // comments or group_comments
+	reactionType string // target type in reactions, mentions and moderatedContentTypes
+	// lookup selects user_id, post_id, content, image_url, removed (0/1),
+	// the post's author and the group's owner (0 for posts) for comment ?.
+	lookup string
+	url    string // link to the comment's post or group, %d is filled from urlID
+}
+
+var (
+	postCommentKind = commentKind{
+		table:        "comments",
+		reactionType: "comment",
+		lookup: `SELECT c.user_id, c.post_id, c.content, IFNULL(c.image_url, ''), c.removed_at IS NOT NULL, p.author_id, 0, p.id
+			FROM comments c JOIN posts p ON p.id = c.post_id WHERE c.id = ?`,
+		url: "/posts/%d",
+	}
+	groupCommentKind = commentKind{
+		table:        "group_comments",
+		reactionType: "group_comment",
+		lookup: `SELECT c.user_id, c.post_id, c.content, IFNULL(c.image_url, ''), c.removed_at IS NOT NULL, p.author_id, g.owner_id, g.id
+			FROM group_comments c JOIN group_posts p ON p.id = c.post_id JOIN groups g ON g.id = p.group_id WHERE c.id = ?`,
+		url: "/groups/%d",
+	}
+)
+
+type storedComment struct {
+	ID, AuthorID, PostID int64
+	Content, ImageURL    string
+	Removed              bool
+	PostAuthorID         int64
+	GroupOwnerID         int64
+	urlID                int64
+}
+
+// mentionTarget is c as an item that can contain mentions.
+func (kind commentKind) mentionTarget(c *storedComment) MentionTarget {
+	if kind.table == "group_comments" {
+		return groupMentionTarget("group_comment", c.ID, c.urlID)
+	}
+	return commentMentionTarget(c.ID, c.PostID)
+}
+
+func loadStoredComment(kind commentKind, id int64) (*storedComment, error) {
+	c := storedComment{ID: id}
+	err := db.DB.QueryRow(kind.lookup, id).Scan(&c.AuthorID, &c.PostID, &c.Content, &c.ImageURL, &c.Removed,
+		&c.PostAuthorID, &c.GroupOwnerID, &c.urlID)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// POST /api/posts/comment/update - { comment_id, content, image_url }
+func UpdateCommentHandler(w http.ResponseWriter, r *http.Request) {
+	updateComment(w, r, postCommentKind)
+}
+
+// POST /api/group/comment/update - { comment_id, content, image_url }
+func UpdateGroupCommentHandler(w http.ResponseWriter, r *http.Request) {
+	updateComment(w, r, groupCommentKind)
+}
+
+// POST /api/posts/comment/delete - { comment_id, reason }
+// The comment's author deletes it; the post's author removes it.
+func DeleteCommentHandler(w http.ResponseWriter, r *http.Request) {
+	deleteComment(w, r, postCommentKind)
+}
+
+// POST /api/group/comment/delete - { comment_id, reason }
+// The comment's author deletes it; the post's author or the group's owner removes it.
+func DeleteGroupCommentHandler(w http.ResponseWriter, r *http.Request) {
+	deleteComment(w, r, groupCommentKind)
+}
+
+// updateComment lets the author change a comment's text (and image, if
+// image_url is sent). The previous text goes to the audit log.
+func updateComment(w http.ResponseWriter, r *http.Request, kind commentKind) {
+	if r.Method != http.MethodPost {
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	uid := utils.GetUserIDFromContext(r)
+	if uid == "" {
+		utils.Error(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	userID, _ := strconv.ParseInt(uid, 10, 64)
+
+	var payload struct {
+		CommentID int64   `json:"comment_id"`
+		Content   string  `json:"content"`
+		ImageURL  *string `json:"image_url"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.CommentID <= 0 {
+		utils.Error(w, http.StatusBadRequest, "Invalid input")
+		return
+	}
+	c, err := loadStoredComment(kind, payload.CommentID)
+	if err != nil || c.Removed {
+		utils.Error(w, http.StatusNotFound, "Comment not found")
+		return
+	}
+	if c.AuthorID != userID {
+		utils.Error(w, http.StatusForbidden, "You can only edit your own comments")
+		return
+	}
+	image := c.ImageURL
+	if payload.ImageURL != nil {
+		image = normalizeURL(*payload.ImageURL)
+	}
+	if strings.TrimSpace(payload.Content) == "" && image == "" {
+		utils.Error(w, http.StatusBadRequest, "Comment cannot be empty")
+		return
+	}
+	if payload.Content == c.Content && image == c.ImageURL {
+		utils.JSON(w, http.StatusOK, map[string]string{"status": "unchanged"})
+		return
+	}
+	if _, err := db.DB.Exec("UPDATE "+kind.table+" SET content = ?, image_url = ?, edited_at = ? WHERE id = ?",
+		payload.Content, image, time.Now(), c.ID); err != nil {
+		log.Printf("Failed to update %s %d: %v", kind.reactionType, c.ID, err)
+		utils.Error(w, http.StatusInternalServerError, "Failed to update comment")
+		return
+	}
+	// archived first, so the old image counts as still in use
+	archived := archiveComment(kind, c, "comment.edit", nil)
+	if image != c.ImageURL {
+		removeUnreferencedUploads([]string{c.ImageURL})
+	}
+	Audit(r, "comment.edit", c.AuthorID, userID, archived)
+	mentions := SaveMentions(kind.mentionTarget(c), payload.Content, userID)
+	utils.JSON(w, http.StatusOK, map[string]interface{}{"status": "updated", "mentions": mentions})
+}
+
+// deleteComment deletes a comment for its author (or leaves a tombstone when
+// it has replies), and leaves a tombstone when the post's author or group's
+// owner removes it. Either way the text is kept in comment_archive.
+func deleteComment(w http.ResponseWriter, r *http.Request, kind commentKind) {
+	if r.Method != http.MethodPost {
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	uid := utils.GetUserIDFromContext(r)
+	if uid == "" {
+		utils.Error(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	userID, _ := strconv.ParseInt(uid, 10, 64)
+
+	var payload struct {
+		CommentID int64  `json:"comment_id"`
+		Reason    string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.CommentID <= 0 {
+		utils.Error(w, http.StatusBadRequest, "Invalid input")
+		return
+	}
+	c, err := loadStoredComment(kind, payload.CommentID)
+	if err != nil || c.Removed {
+		utils.Error(w, http.StatusNotFound, "Comment not found")
+		return
+	}
+	isAuthor := c.AuthorID == userID
+	if !isAuthor && c.PostAuthorID != userID && c.GroupOwnerID != userID {
+		utils.Error(w, http.StatusForbidden, "You can't remove this comment")
+		return
+	}
+
+	replies := commentReplies(kind, c.ID)
+	action := "comment.remove"
+	if isAuthor {
+		action = "comment.delete"
+	}
+	// archived first, so its image counts as still in use
+	reason := strings.TrimSpace(payload.Reason)
+	archived := archiveComment(kind, c, action, map[string]interface{}{"reason": reason})
+	if isAuthor && replies == 0 {
+		err = removeContent(moderatedContentTypes[kind.reactionType], c.ID)
+	} else {
+		err = tombstoneComment(kind, c, userID)
+	}
+	if err != nil {
+		log.Printf("Failed to remove %s %d: %v", kind.reactionType, c.ID, err)
+		db.DB.Exec("DELETE FROM comment_archive WHERE id = ?", archived["archive_id"])
+		utils.Error(w, http.StatusInternalServerError, "Failed to delete comment")
+		return
+	}
+
+	Audit(r, action, c.AuthorID, userID, archived)
+	if !isAuthor {
+		_ = Notify(c.AuthorID, userID, "comment_removed", map[string]interface{}{
+			"comment_type": kind.reactionType,
+			"comment_id":   c.ID,
+			"post_id":      c.PostID,
+			"reason":       reason,
+			"url":          fmt.Sprintf(kind.url, c.urlID),
+		})
+	}
+	utils.JSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+type archivedComment struct {
+	ID          int64  `json:"id"`
+	Action      string `json:"action"`
+	Content     string `json:"content"`
+	ImageURL    string `json:"image_url"`
+	ContentHash string `json:"content_hash"`
+	ArchivedAt  string `json:"archived_at"`
+}
+
+// GET /api/admin/comments/archive?comment_type=&comment_id= - the archived
+// versions of a comment, newest first (moderators and admins). comment_type is
+// comment or group_comment; the audit entries' archive_id and content_hash
+// point here.
+func AdminCommentArchiveHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	q := r.URL.Query()
+	commentType := q.Get("comment_type")
+	commentID, _ := strconv.ParseInt(q.Get("comment_id"), 10, 64)
+	if (commentType != postCommentKind.reactionType && commentType != groupCommentKind.reactionType) || commentID <= 0 {
+		utils.Error(w, http.StatusBadRequest, "Invalid input")
+		return
+	}
+	rows, err := db.DB.Query(`SELECT id, action, IFNULL(content, ''), IFNULL(image_url, ''), archived_at FROM comment_archive
+		WHERE comment_type = ? AND comment_id = ? ORDER BY id DESC`, commentType, commentID)
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, "Failed to load archived comment")
+		return
+	}
+	defer rows.Close()
+	versions := []archivedComment{}
+	for rows.Next() {
+		var v archivedComment
+		if err := rows.Scan(&v.ID, &v.Action, &v.Content, &v.ImageURL, &v.ArchivedAt); err != nil {
+			continue
+		}
+		v.ContentHash = commentContentHash(v.Content, v.ImageURL)
+		versions = append(versions, v)
+	}
+	utils.JSON(w, http.StatusOK, map[string]interface{}{"comment_type": commentType, "comment_id": commentID, "versions": versions})
+}
+
+// archiveComment keeps c's content as it was before action in
+// comment_archive and returns the audit data for it, with extra added. The
+// audit log only records the archive row and a hash of the content: the text
+// is personal data that has to go when its author deletes their account.
+func archiveComment(kind commentKind, c *storedComment, action string, extra map[string]interface{}) map[string]interface{} {
+	data := map[string]interface{}{
+		"comment_type": kind.reactionType, "comment_id": c.ID, "post_id": c.PostID,
+		"content_hash": commentContentHash(c.Content, c.ImageURL),
+	}
+	for k, v := range extra {
+		data[k] = v
+	}
+	res, err := db.DB.Exec("INSERT INTO comment_archive (comment_type, comment_id, post_id, author_id, action, content, image_url) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		kind.reactionType, c.ID, c.PostID, c.AuthorID, action, c.Content, c.ImageURL)
+	if err != nil {
+		log.Printf("Failed to archive %s %d: %v", kind.reactionType, c.ID, err)
+		return data
+	}
+	data["archive_id"], _ = res.LastInsertId()
+	return data
+}
+
+// commentContentHash lets an audit entry vouch for an archived comment
+// without holding its text.
+func commentContentHash(content, imageURL string) string {
+	canonical, _ := json.Marshal([]string{content, imageURL})
+	sum := sha256.Sum256(canonical)
+	return hex.EncodeToString(sum[:])
+}
+
+// commentReplies counts the direct replies to a comment.
+func commentReplies(kind commentKind, id int64) int {
+	var n int
+	db.DB.QueryRow("SELECT COUNT(1) FROM "+kind.table+" WHERE parent_id = ?", id).Scan(&n)
+	return n
+}
+
+// tombstoneComment blanks a comment but keeps its row, so its replies stay in place.
+func tombstoneComment(kind commentKind, c *storedComment, actorID int64) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("UPDATE "+kind.table+" SET content = '', image_url = NULL, removed_at = ?, removed_by = ? WHERE id = ?",
+		time.Now(), actorID, c.ID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM reactions WHERE target_type = ? AND target_id = ?", kind.reactionType, c.ID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM mentions WHERE target_type = ? AND target_id = ?", kind.reactionType, c.ID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	removeUnreferencedUploads([]string{c.ImageURL})
+	return nil
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"social-network/backend/db"
+)
+
+func TestRemovedCommentTextStaysOutOfAuditLog(t *testing.T) {
+	setupVisibilityDB(t)
+	if _, err := db.DB.Exec("INSERT INTO comments (id, post_id, user_id, content) VALUES (1, ?, ?, 'first secret')", publicPost, follower); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	UpdateCommentHandler(rec, asUser(httptest.NewRequest(http.MethodPost, "/api/posts/comment/update",
+		strings.NewReader(`{"comment_id": 1, "content": "second secret"}`)), follower))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("edit: status %d: %s", rec.Code, rec.Body)
+	}
+	// the post's author removes it
+	rec = httptest.NewRecorder()
+	DeleteCommentHandler(rec, asUser(httptest.NewRequest(http.MethodPost, "/api/posts/comment/delete",
+		strings.NewReader(`{"comment_id": 1, "reason": "spam"}`)), author))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("remove: status %d: %s", rec.Code, rec.Body)
+	}
+
+	rows, err := db.DB.Query("SELECT action, data FROM audit_log WHERE action LIKE 'comment.%' ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var actions []string
+	for rows.Next() {
+		var action, data string
+		rows.Scan(&action, &data)
+		actions = append(actions, action)
+		if strings.Contains(data, "secret") || !strings.Contains(data, "archive_id") || !strings.Contains(data, "content_hash") {
+			t.Errorf("%s audit data = %s, want only the archive id and hash", action, data)
+		}
+	}
+	rows.Close()
+	if strings.Join(actions, ",") != "comment.edit,comment.remove" {
+		t.Fatalf("audited %v", actions)
+	}
+
+	rec = httptest.NewRecorder()
+	AdminCommentArchiveHandler(rec, httptest.NewRequest(http.MethodGet, "/api/admin/comments/archive?comment_type=comment&comment_id=1", nil))
+	if body := rec.Body.String(); rec.Code != http.StatusOK || !strings.Contains(body, "first secret") || !strings.Contains(body, "second secret") {
+		t.Fatalf("archive: status %d: %s", rec.Code, body)
+	}
+
+	if err := purgeAccount(follower); err != nil {
+		t.Fatal(err)
+	}
+	var left int
+	db.DB.QueryRow("SELECT COUNT(1) FROM comment_archive").Scan(&left)
+	if left != 0 {
+		t.Errorf("%d archived versions left after the author's account was purged", left)
+	}
+}
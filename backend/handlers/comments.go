@@ -1 +1,118 @@
 package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"social-network/backend/db"
+	"social-network/backend/utils"
+)
+
+// Comment threads: a comment with parent_id set is a reply. Lists of comments
+// only carry the top level with each comment's reply_count; replies are
+// fetched a page at a time, oldest first.
+
+// GET /api/posts/comment/replies?comment_id=&cursor=&limit=
+// Returns { replies, next_cursor } for a comment on a post the requester can see.
+func CommentRepliesHandler(w http.ResponseWriter, r *http.Request) {
+	viewerID := requestViewer(w, r)
+	commentID, _ := strconv.ParseInt(r.URL.Query().Get("comment_id"), 10, 64)
+
+	if _, ok, err := CanViewComment(viewerID, commentID); err != nil || !ok {
+		utils.Error(w, http.StatusNotFound, "Comment not found")
+		return
+	}
+	listReplies(w, r, "comments", "comment", commentID, viewerID)
+}
+
+// GET /api/group/comment/replies?comment_id=&cursor=&limit= (group members only)
+// Returns { replies, next_cursor }.
+func GroupCommentRepliesHandler(w http.ResponseWriter, r *http.Request) {
+	uid := utils.GetUserIDFromContext(r)
+	if uid == "" {
+		utils.Error(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	userID, _ := strconv.ParseInt(uid, 10, 64)
+	commentID, _ := strconv.ParseInt(r.URL.Query().Get("comment_id"), 10, 64)
+
+	var groupID int64
+	err := db.DB.QueryRow(`SELECT gp.group_id FROM group_comments gc
+		JOIN group_posts gp ON gp.id = gc.post_id
+		JOIN group_members m ON m.group_id = gp.group_id AND m.user_id = ?
+		WHERE gc.id = ?`, userID, commentID).Scan(&groupID)
+	if err != nil {
+		utils.Error(w, http.StatusNotFound, "Comment not found")
+		return
+	}
+	listReplies(w, r, "group_comments", "group_comment", commentID, userID)
+}
+
+// listReplies writes a page of direct replies to parentID from table
+// (comments or group_comments); reactionType is its reaction and mention
+// target type.
+func listReplies(w http.ResponseWriter, r *http.Request, table, reactionType string, parentID, viewerID int64) {
+	cursor, err := parseFeedCursor(r.URL.Query().Get("cursor"))
+	if err != nil {
+		utils.Error(w, http.StatusBadRequest, "Invalid cursor")
+		return
+	}
+	limit := pageLimit(r)
+
+	where := "c.parent_id = ?"
+	args := []interface{}{parentID}
+	if cursor != nil {
+		where += " AND (c.created_at > ? OR (c.created_at = ? AND c.id > ?))"
+		args = append(args, cursor.CreatedAt, cursor.CreatedAt, cursor.ID)
+	}
+	rows, err := db.DB.Query(`
+		SELECT c.id, c.post_id, c.parent_id, c.user_id, c.content, c.image_url, c.created_at, CAST(c.created_at AS TEXT),
+			IFNULL(u.nickname, ''), c.edited_at IS NOT NULL, c.removed_at IS NOT NULL,
+			(SELECT COUNT(1) FROM `+table+` r WHERE r.parent_id = c.id)
+		FROM `+table+` c
+		LEFT JOIN users u ON c.user_id = u.id
+		WHERE `+where+`
+		ORDER BY c.created_at ASC, c.id ASC
+		LIMIT ?`, append(args, limit+1)...)
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, "Failed to load replies")
+		return
+	}
+	defer rows.Close()
+
+	replies := []commentDTO{}
+	for rows.Next() {
+		var c commentDTO
+		var image sql.NullString
+		if err := rows.Scan(&c.ID, &c.PostID, &c.ParentID, &c.UserID, &c.Content, &image, &c.CreatedAt, &c.rawCreated,
+			&c.Nickname, &c.Edited, &c.Removed, &c.ReplyCount); err != nil {
+			continue
+		}
+		c.ImageURL = normalizeURL(image.String)
+		if c.Removed {
+			c.Content = removedCommentText
+		}
+		replies = append(replies, c)
+	}
+	rows.Close()
+
+	resp := map[string]interface{}{"next_cursor": nil}
+	if len(replies) > limit {
+		replies = replies[:limit]
+		last := replies[limit-1]
+		resp["next_cursor"] = feedCursor{CreatedAt: last.rawCreated, ID: last.ID}.String()
+	}
+	ids := make([]int64, len(replies))
+	for i := range replies {
+		ids[i] = replies[i].ID
+	}
+	reactions := loadReactions(reactionType, ids, viewerID)
+	mentions := loadMentions(reactionType, ids)
+	for i := range replies {
+		replies[i].reactionSummary = reactions[replies[i].ID]
+		replies[i].Mentions = mentions[replies[i].ID]
+	}
+	resp["replies"] = replies
+	utils.JSON(w, http.StatusOK, resp)
+}
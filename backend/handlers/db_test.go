@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"social-network/backend/db"
+	"social-network/backend/utils"
+)
+
+// setupTestDB points db.DB at a fresh database with every migration applied.
+func setupTestDB(t *testing.T) {
+	t.Helper()
+	conn, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := filepath.Glob(filepath.Join("..", "db", "migrations", "sqlite", "*.up.sql"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no migrations found: %v", err)
+	}
+	sort.Strings(files)
+	for _, f := range files {
+		raw, err := os.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := conn.Exec(string(raw)); err != nil {
+			t.Fatalf("%s: %v", filepath.Base(f), err)
+		}
+	}
+	prev := db.DB
+	db.DB = conn
+	utils.SetDB(conn)
+	t.Cleanup(func() {
+		db.DB = prev
+		conn.Close()
+	})
+}
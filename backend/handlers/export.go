@@ -0,0 +1,376 @@
+package handlers
+
+import (
+	"archive/zip"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"social-network/backend/config"
+	"social-network/backend/db"
+	"social-network/backend/utils"
+)
+
+// exportSection is one JSON file in a data export archive.
+type exportSection struct {
+	file  string
+	query string
+	// imageColumn names the column holding an upload URL whose file is
+	// copied into the archive; empty when the section has no media.
+	imageColumn string
+}
+
+// exportSections lists everything stored about a user. Every query takes the
+// user's id as its only parameter (?1).
+var exportSections = []exportSection{
+	{"profile.json", `SELECT id, email, first_name, last_name, date_of_birth, avatar, nickname, about_me,
+		profile_type, verified_at, totp_enabled FROM users WHERE id = ?1`, "avatar"},
+	{"posts.json", `SELECT p.id, p.content, p.image_url, p.privacy,
+		(SELECT GROUP_CONCAT(a.user_id) FROM post_audience a WHERE a.post_id = p.id) AS allowed_user_ids, p.created_at, p.edited_at
+		FROM posts p WHERE p.author_id = ?1 ORDER BY p.id`, "image_url"},
+	{"post_revisions.json", `SELECT r.id, r.post_id, r.content, r.image_url, r.privacy, r.replaced_at
+		FROM post_revisions r JOIN posts p ON p.id = r.post_id WHERE p.author_id = ?1 ORDER BY r.id`, "image_url"},
+	{"comments.json", "SELECT id, post_id, parent_id, content, image_url, created_at FROM comments WHERE user_id = ?1 ORDER BY id", "image_url"},
+	{"comment_archive.json", "SELECT id, comment_type, comment_id, post_id, action, content, image_url, archived_at FROM comment_archive WHERE author_id = ?1 ORDER BY id", ""},
+	{"reactions.json", "SELECT target_type, target_id, reaction, created_at FROM reactions WHERE user_id = ?1 AND reaction IS NOT NULL ORDER BY created_at", ""},
+	{"messages.json", `SELECT m.id, m.sender_id, s.nickname AS sender_nickname, m.receiver_id, r.nickname AS receiver_nickname,
+		m.content, m.created_at FROM messages m
+		LEFT JOIN users s ON s.id = m.sender_id LEFT JOIN users r ON r.id = m.receiver_id
+		WHERE m.sender_id = ?1 OR m.receiver_id = ?1 ORDER BY m.id`, ""},
+	{"followers.json", `SELECT u.id, u.nickname, f.created_at FROM followers f JOIN users u ON u.id = f.follower_id
+		WHERE f.followed_id = ?1 ORDER BY f.id`, ""},
+	{"following.json", `SELECT u.id, u.nickname, f.created_at FROM followers f JOIN users u ON u.id = f.followed_id
+		WHERE f.follower_id = ?1 ORDER BY f.id`, ""},
+	{"follow_requests.json", "SELECT id, sender_id, receiver_id, status, created_at FROM follow_requests WHERE sender_id = ?1 OR receiver_id = ?1 ORDER BY id", ""},
+	{"groups.json", `SELECT g.id, g.name, g.description, m.role, m.joined_at FROM group_members m JOIN groups g ON g.id = m.group_id
+		WHERE m.user_id = ?1 ORDER BY m.id`, ""},
+	{"group_posts.json", "SELECT id, group_id, content, image_url, created_at FROM group_posts WHERE author_id = ?1 ORDER BY id", "image_url"},
+	{"group_comments.json", "SELECT id, post_id, parent_id, content, image_url, created_at FROM group_comments WHERE user_id = ?1 ORDER BY id", "image_url"},
+	{"group_messages.json", "SELECT id, group_id, content, created_at FROM group_messages WHERE sender_id = ?1 ORDER BY id", ""},
+	{"events.json", "SELECT id, group_id, title, description, event_time, created_at FROM events WHERE creator_id = ?1 ORDER BY id", ""},
+	{"event_votes.json", `SELECT v.event_id, e.title AS event_title, v.vote, v.created_at FROM event_votes v
+		LEFT JOIN events e ON e.id = v.event_id WHERE v.user_id = ?1 ORDER BY v.id`, ""},
+	{"notifications.json", "SELECT id, actor_id, type, data, is_read, created_at FROM notifications WHERE recipient_id = ?1 ORDER BY id", ""},
+	{"invites.json", "SELECT id, code, max_uses, uses, expires_at, revoked_at, created_at FROM invite_codes WHERE created_by = ?1 ORDER BY id", ""},
+	{"security_log.json", "SELECT id, actor_id, action, ip_address, user_agent, data, created_at FROM audit_log WHERE user_id = ?1 ORDER BY id", ""},
+	{"sessions.json", "SELECT id, user_agent, ip_address, created_at, last_seen_at, expiry FROM sessions WHERE user_id = ?1 ORDER BY id", ""},
+}
+
+// POST /api/account/export - start building a personal data archive
+// GET  /api/account/export - list the user's archives
+// The archive is built in the background; a "data_export_ready" notification
+// with the download link is sent when it is done.
+func DataExportHandler(w http.ResponseWriter, r *http.Request) {
+	uid := utils.GetUserIDFromContext(r)
+	if uid == "" {
+		utils.Error(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	userID, _ := strconv.ParseInt(uid, 10, 64)
+
+	switch r.Method {
+	case http.MethodGet:
+		listDataExports(w, userID)
+	case http.MethodPost:
+		var pending int
+		if err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM data_exports WHERE user_id = ? AND status = 'pending')", userID).Scan(&pending); err != nil {
+			utils.Error(w, http.StatusInternalServerError, "Database error")
+			return
+		}
+		if pending != 0 {
+			utils.Error(w, http.StatusConflict, "An export is already being prepared")
+			return
+		}
+		res, err := db.DB.Exec("INSERT INTO data_exports (user_id, status, created_at) VALUES (?, 'pending', ?)", userID, time.Now())
+		if err != nil {
+			log.Printf("Failed to create data export for user %d: %v", userID, err)
+			utils.Error(w, http.StatusInternalServerError, "Failed to start export")
+			return
+		}
+		exportID, _ := res.LastInsertId()
+		go runDataExport(exportID, userID)
+		utils.JSON(w, http.StatusAccepted, map[string]interface{}{"export_id": exportID, "status": "pending"})
+	default:
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+func listDataExports(w http.ResponseWriter, userID int64) {
+	rows, err := db.DB.Query(`SELECT id, status, size_bytes, created_at, completed_at, expires_at
+		FROM data_exports WHERE user_id = ? ORDER BY id DESC`, userID)
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	defer rows.Close()
+
+	out := []map[string]interface{}{}
+	for rows.Next() {
+		var id int64
+		var status string
+		var size sql.NullInt64
+		var created time.Time
+		var completed, expires sql.NullTime
+		if err := rows.Scan(&id, &status, &size, &created, &completed, &expires); err != nil {
+			continue
+		}
+		e := map[string]interface{}{"id": id, "status": status, "created_at": created}
+		if status == "ready" {
+			e["size_bytes"] = size.Int64
+			e["completed_at"] = completed.Time
+			e["expires_at"] = expires.Time
+			e["download_url"] = dataExportURL(id)
+		}
+		out = append(out, e)
+	}
+	utils.JSON(w, http.StatusOK, out)
+}
+
+// GET /api/account/export/download?id=
+func DownloadDataExportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	uid := utils.GetUserIDFromContext(r)
+	if uid == "" {
+		utils.Error(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	userID, _ := strconv.ParseInt(uid, 10, 64)
+	exportID, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		utils.Error(w, http.StatusBadRequest, "Invalid export id")
+		return
+	}
+
+	var filePath sql.NullString
+	var expires sql.NullTime
+	err = db.DB.QueryRow("SELECT file_path, expires_at FROM data_exports WHERE id = ? AND user_id = ? AND status = 'ready'", exportID, userID).
+		Scan(&filePath, &expires)
+	if err != nil || !filePath.Valid || time.Now().After(expires.Time) {
+		utils.Error(w, http.StatusNotFound, "Export not found")
+		return
+	}
+	f, err := os.Open(filePath.String)
+	if err != nil {
+		utils.Error(w, http.StatusNotFound, "Export not found")
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, "Server error")
+		return
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="data-export-%d.zip"`, exportID))
+	w.Header().Set("Cache-Control", "no-store")
+	http.ServeContent(w, r, "", info.ModTime(), f)
+}
+
+func dataExportURL(exportID int64) string {
+	return fmt.Sprintf("/api/account/export/download?id=%d", exportID)
+}
+
+// runDataExport writes the archive for one export request and notifies the user.
+func runDataExport(exportID, userID int64) {
+	filePath, size, err := writeDataExport(exportID, userID)
+	if err != nil {
+		log.Printf("Data export %d for user %d failed: %v", exportID, userID, err)
+		db.DB.Exec("UPDATE data_exports SET status = 'failed', completed_at = ? WHERE id = ?", time.Now(), exportID)
+		Notify(userID, 0, "data_export_failed", map[string]interface{}{"export_id": exportID})
+		return
+	}
+	now := time.Now()
+	expires := now.Add(config.Current.DataExportTTL)
+	if _, err := db.DB.Exec("UPDATE data_exports SET status = 'ready', file_path = ?, size_bytes = ?, completed_at = ?, expires_at = ? WHERE id = ?",
+		filePath, size, now, expires, exportID); err != nil {
+		log.Printf("Failed to record data export %d: %v", exportID, err)
+		os.Remove(filePath)
+		return
+	}
+	Notify(userID, 0, "data_export_ready", map[string]interface{}{
+		"export_id":    exportID,
+		"download_url": dataExportURL(exportID),
+		"expires_at":   expires,
+	})
+}
+
+// writeDataExport builds the ZIP archive: one JSON file per section plus the
+// user's uploaded images under media/. Image URLs in the JSON are rewritten to
+// point at the copies inside the archive.
+func writeDataExport(exportID, userID int64) (string, int64, error) {
+	dir := config.Current.DataExportDir
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", 0, err
+	}
+	token, err := utils.NewToken()
+	if err != nil {
+		return "", 0, err
+	}
+	// the random part keeps archive names unguessable on disk
+	final := filepath.Join(dir, fmt.Sprintf("export-%d-%s.zip", exportID, token[:16]))
+	tmp := final + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(tmp)
+
+	zw := zip.NewWriter(f)
+	media := map[string]string{} // upload URL -> path inside the archive
+	for _, s := range exportSections {
+		records, err := queryRecords(s.query, userID)
+		if err != nil {
+			f.Close()
+			return "", 0, fmt.Errorf("%s: %w", s.file, err)
+		}
+		if s.imageColumn != "" {
+			for _, rec := range records {
+				u, _ := rec[s.imageColumn].(string)
+				if u == "" {
+					continue
+				}
+				if name, ok := addExportMedia(zw, media, u); ok {
+					rec[s.imageColumn] = name
+				}
+			}
+		}
+		// profile.json holds a single object rather than a list
+		var doc interface{} = records
+		if s.file == "profile.json" && len(records) == 1 {
+			doc = records[0]
+		}
+		wr, err := zw.Create(s.file)
+		if err != nil {
+			f.Close()
+			return "", 0, err
+		}
+		enc := json.NewEncoder(wr)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(doc); err != nil {
+			f.Close()
+			return "", 0, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		f.Close()
+		return "", 0, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return "", 0, err
+	}
+	if err := f.Close(); err != nil {
+		return "", 0, err
+	}
+	if err := os.Rename(tmp, final); err != nil {
+		return "", 0, err
+	}
+	return final, info.Size(), nil
+}
+
+// addExportMedia copies one uploaded file into the archive (once) and returns
+// its name there. Missing files are skipped.
+func addExportMedia(zw *zip.Writer, media map[string]string, u string) (string, bool) {
+	if name, ok := media[u]; ok {
+		return name, true
+	}
+	src, ok := uploadFilePath(normalizeURL(u))
+	if !ok {
+		return "", false
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return "", false
+	}
+	defer in.Close()
+	rel, _ := filepath.Rel(filepath.Join("backend", "uploads"), src)
+	name := path.Join("media", filepath.ToSlash(rel))
+	wr, err := zw.Create(name)
+	if err != nil {
+		return "", false
+	}
+	if _, err := io.Copy(wr, in); err != nil {
+		log.Printf("Failed to add %s to data export: %v", src, err)
+		return "", false
+	}
+	media[u] = name
+	return name, true
+}
+
+// queryRecords runs query with userID and returns each row as a column -> value map.
+func queryRecords(query string, userID int64) ([]map[string]interface{}, error) {
+	rows, err := db.DB.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	out := []map[string]interface{}{}
+	for rows.Next() {
+		vals := make([]interface{}, len(cols))
+		ptrs := make([]interface{}, len(cols))
+		for i := range vals {
+			ptrs[i] = &vals[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		rec := make(map[string]interface{}, len(cols))
+		for i, c := range cols {
+			if b, ok := vals[i].([]byte); ok {
+				rec[c] = string(b)
+			} else {
+				rec[c] = vals[i]
+			}
+		}
+		out = append(out, rec)
+	}
+	return out, rows.Err()
+}
+
+// CleanupDataExports removes archives past their expiry, and records of
+// exports that never finished (e.g. interrupted by a restart).
+func CleanupDataExports() {
+	now := time.Now()
+	rows, err := db.DB.Query("SELECT id, file_path FROM data_exports WHERE status = 'ready' AND expires_at < ?", now)
+	if err != nil {
+		log.Println("Data export cleanup query error:", err)
+		return
+	}
+	var ids []int64
+	var files []string
+	for rows.Next() {
+		var id int64
+		var p sql.NullString
+		if rows.Scan(&id, &p) == nil {
+			ids = append(ids, id)
+			files = append(files, p.String)
+		}
+	}
+	rows.Close()
+	for i, id := range ids {
+		if files[i] != "" {
+			if err := os.Remove(files[i]); err != nil && !os.IsNotExist(err) {
+				log.Printf("Failed to remove data export %s: %v", files[i], err)
+				continue
+			}
+		}
+		db.DB.Exec("DELETE FROM data_exports WHERE id = ?", id)
+	}
+	db.DB.Exec("UPDATE data_exports SET status = 'failed', completed_at = ? WHERE status = 'pending' AND created_at < ?", now, now.Add(-time.Hour))
+}
@@ -47,6 +47,7 @@ func FollowHandler(w http.ResponseWriter, r *http.Request) {
 			utils.Error(w, http.StatusInternalServerError, "Failed to follow")
 			return
 		}
+		QueueFollow(userID, payload.TargetID)
 		// create notification for the target user about the new follower
 		_ = Notify(payload.TargetID, userID, "new_follower", map[string]interface{}{"follower_id": userID, "url": fmt.Sprintf("/profile/%d", userID)})
 		utils.JSON(w, http.StatusOK, map[string]string{"status": "followed"})
@@ -105,6 +106,7 @@ func FollowHandler(w http.ResponseWriter, r *http.Request) {
 			utils.Error(w, http.StatusInternalServerError, "Failed to follow")
 			return
 		}
+		QueueFollow(userID, payload.TargetID)
 
 		// Send notification as an immediate "follow_request_accepted"
 		_ = Notify(payload.TargetID, userID, "follow_request_accepted",
@@ -172,6 +174,7 @@ func AcceptFollowHandler(w http.ResponseWriter, r *http.Request) {
 		utils.Error(w, http.StatusInternalServerError, "Failed")
 		return
 	}
+	QueueFollow(payload.SenderID, userID)
 	// notify sender their request was accepted
 	_ = Notify(payload.SenderID, userID, "follow_request_accepted", map[string]interface{}{"follower_id": userID, "url": fmt.Sprintf("/profile/%d", userID)})
 	utils.JSON(w, http.StatusOK, map[string]string{"status": "accepted"})
@@ -234,6 +237,7 @@ func UnfollowHandler(w http.ResponseWriter, r *http.Request) {
 		utils.Error(w, http.StatusInternalServerError, "Failed")
 		return
 	}
+	QueueUnfollow(userID, payload.TargetID)
 	utils.JSON(w, http.StatusOK, map[string]string{"status": "unfollowed"})
 }
 
@@ -6,6 +6,7 @@ import (
 	"strconv"
 
 	"social-network/backend/db"
+	"social-network/backend/models"
 	"social-network/backend/utils"
 )
 
@@ -78,11 +79,12 @@ func ListGroupMessagesHandler(w http.ResponseWriter, r *http.Request) {
 	defer rows.Close()
 
 	type msg struct {
-		ID         int64          `json:"id"`
-		SenderID   int64          `json:"sender_id"`
-		Content    string         `json:"content"`
-		CreatedAt  sql.NullString `json:"created_at"`
-		SenderName string         `json:"sender_name"`
+		ID         int64            `json:"id"`
+		SenderID   int64            `json:"sender_id"`
+		Content    string           `json:"content"`
+		CreatedAt  sql.NullString   `json:"created_at"`
+		SenderName string           `json:"sender_name"`
+		Mentions   []models.Mention `json:"mentions"`
 	}
 
 	var out []msg
@@ -98,5 +100,14 @@ func ListGroupMessagesHandler(w http.ResponseWriter, r *http.Request) {
 		out[i], out[j] = out[j], out[i]
 	}
 
+	ids := make([]int64, len(out))
+	for i := range out {
+		ids[i] = out[i].ID
+	}
+	mentions := loadMentions("group_message", ids)
+	for i := range out {
+		out[i].Mentions = mentions[out[i].ID]
+	}
+
 	utils.JSON(w, http.StatusOK, out)
 }
@@ -10,6 +10,7 @@ import (
 	"os"
 	"path/filepath"
 	"social-network/backend/db"
+	"social-network/backend/models"
 	"social-network/backend/utils"
 	"strconv"
 	"strings"
@@ -276,12 +277,14 @@ func CreateGroupPostHandler(w http.ResponseWriter, r *http.Request) {
 		utils.Error(w, http.StatusForbidden, "Not a member")
 		return
 	}
-	_, err = db.DB.Exec("INSERT INTO group_posts (group_id, author_id, content, image_url) VALUES (?, ?, ?, ?)", gid, userID, content, imageURL)
+	res, err := db.DB.Exec("INSERT INTO group_posts (group_id, author_id, content, image_url) VALUES (?, ?, ?, ?)", gid, userID, content, imageURL)
 	if err != nil {
 		utils.Error(w, http.StatusInternalServerError, "Failed to create post")
 		return
 	}
-	utils.JSON(w, http.StatusOK, map[string]string{"status": "created"})
+	postID, _ := res.LastInsertId()
+	mentions := SaveMentions(groupMentionTarget("group_post", postID, gid), content, userID)
+	utils.JSON(w, http.StatusOK, map[string]interface{}{"status": "created", "id": postID, "mentions": mentions})
 }
 
 // ListGroupPostsHandler - GET /api/group/posts?group_id=<id>
@@ -299,23 +302,35 @@ func ListGroupPostsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	defer rows.Close()
 	type P struct {
-		ID       int64  `json:"id"`
-		GroupID  int64  `json:"group_id"`
-		AuthorID int64  `json:"author_id"`
-		Content  string `json:"content"`
-		Image    string `json:"image_url"`
-		Created  string `json:"created_at"`
+		ID       int64            `json:"id"`
+		GroupID  int64            `json:"group_id"`
+		AuthorID int64            `json:"author_id"`
+		Content  string           `json:"content"`
+		Image    string           `json:"image_url"`
+		Created  string           `json:"created_at"`
+		Mentions []models.Mention `json:"mentions"`
+		reactionSummary
 	}
 	var out []P
+	var ids []int64
 	for rows.Next() {
 		var p P
 		rows.Scan(&p.ID, &p.GroupID, &p.AuthorID, &p.Content, &p.Image, &p.Created)
 		out = append(out, p)
+		ids = append(ids, p.ID)
+	}
+	viewerID := requestViewer(w, r)
+	reactions := loadReactions("group_post", ids, viewerID)
+	mentions := loadMentions("group_post", ids)
+	for i := range out {
+		out[i].reactionSummary = reactions[out[i].ID]
+		out[i].Mentions = mentions[out[i].ID]
 	}
 	utils.JSON(w, http.StatusOK, out)
 }
 
-// AddGroupCommentHandler - POST { post_id, content }
+// AddGroupCommentHandler - POST { post_id, parent_id, content }
+// parent_id is optional and makes the comment a reply.
 func AddGroupCommentHandler(w http.ResponseWriter, r *http.Request) {
 	fmt.Println("AddGroupCommentHandler hit")
 
@@ -328,8 +343,9 @@ func AddGroupCommentHandler(w http.ResponseWriter, r *http.Request) {
 	userID, _ := strconv.ParseInt(uid, 10, 64)
 
 	var payload struct {
-		PostID  int64  `json:"post_id"`
-		Content string `json:"content"`
+		PostID   int64  `json:"post_id"`
+		ParentID int64  `json:"parent_id,omitempty"`
+		Content  string `json:"content"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
 		fmt.Println("Bad JSON payload:", err)
@@ -358,9 +374,20 @@ func AddGroupCommentHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// a reply must answer a comment on the same post
+	var parentID interface{}
+	var parentAuthor int64
+	if payload.ParentID > 0 {
+		if err := db.DB.QueryRow("SELECT user_id FROM group_comments WHERE id = ? AND post_id = ? AND removed_at IS NULL", payload.ParentID, payload.PostID).Scan(&parentAuthor); err != nil {
+			utils.Error(w, http.StatusBadRequest, "Invalid parent comment")
+			return
+		}
+		parentID = payload.ParentID
+	}
+
 	// insert
 	fmt.Printf("Attempting insert: post_id=%d, user_id=%d, content='%s'\n", payload.PostID, userID, payload.Content)
-	res, err := db.DB.Exec("INSERT INTO group_comments (post_id, user_id, content) VALUES (?, ?, ?)", payload.PostID, userID, payload.Content)
+	res, err := db.DB.Exec("INSERT INTO group_comments (post_id, parent_id, user_id, content) VALUES (?, ?, ?, ?)", payload.PostID, parentID, userID, payload.Content)
 	if err != nil {
 		fmt.Println("Insert failed:", err)
 		utils.Error(w, http.StatusInternalServerError, "Failed to insert comment")
@@ -369,10 +396,15 @@ func AddGroupCommentHandler(w http.ResponseWriter, r *http.Request) {
 
 	id, _ := res.LastInsertId()
 	fmt.Println("Inserted comment with ID:", id)
-	utils.JSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	if parentAuthor > 0 && parentAuthor != userID {
+		_ = Notify(parentAuthor, userID, "comment_reply", map[string]interface{}{"group_id": gid, "post_id": payload.PostID, "comment_id": id, "parent_id": payload.ParentID, "url": fmt.Sprintf("/groups/%d", gid)})
+	}
+	mentions := SaveMentions(groupMentionTarget("group_comment", id, gid), payload.Content, userID)
+	utils.JSON(w, http.StatusOK, map[string]interface{}{"status": "ok", "id": id, "mentions": mentions})
 }
 
 // ListGroupCommentsHandler - GET /api/group/comments?post_id=<id>
+// Lists top-level comments; replies come from GroupCommentRepliesHandler.
 func ListGroupCommentsHandler(w http.ResponseWriter, r *http.Request) {
     postIDStr := r.URL.Query().Get("post_id")
     if postIDStr == "" {
@@ -386,10 +418,12 @@ func ListGroupCommentsHandler(w http.ResponseWriter, r *http.Request) {
     }
 
     rows, err := db.DB.Query(`
-        SELECT gc.id, gc.post_id, gc.user_id, u.nickname, gc.content, gc.created_at 
+        SELECT gc.id, gc.post_id, gc.user_id, IFNULL(u.nickname, ''), gc.content, gc.created_at,
+            gc.edited_at IS NOT NULL, gc.removed_at IS NOT NULL,
+            (SELECT COUNT(1) FROM group_comments r WHERE r.parent_id = gc.id)
         FROM group_comments gc 
-        JOIN users u ON gc.user_id = u.id
-        WHERE gc.post_id = ? ORDER BY gc.created_at ASC
+        LEFT JOIN users u ON gc.user_id = u.id
+        WHERE gc.post_id = ? AND gc.parent_id IS NULL ORDER BY gc.created_at ASC
     `, pid)
     if err != nil {
         utils.Error(w, http.StatusInternalServerError, "Failed to query comments")
@@ -398,10 +432,16 @@ func ListGroupCommentsHandler(w http.ResponseWriter, r *http.Request) {
     defer rows.Close()
 
     var out []map[string]interface{}
+    var ids []int64
     for rows.Next() {
         var id, postID, userID int64
         var nickname, content, created string
-        rows.Scan(&id, &postID, &userID, &nickname, &content, &created)
+        var replyCount int
+        var edited, removed bool
+        rows.Scan(&id, &postID, &userID, &nickname, &content, &created, &edited, &removed, &replyCount)
+        if removed {
+            content = removedCommentText
+        }
         out = append(out, map[string]interface{}{
             "id": id,
             "post_id": postID,
@@ -409,7 +449,22 @@ func ListGroupCommentsHandler(w http.ResponseWriter, r *http.Request) {
             "nickname": nickname,
             "content": content,
             "created_at": created,
+            "edited": edited,
+            "removed": removed,
+            "reply_count": replyCount,
         })
+        ids = append(ids, id)
+    }
+    viewerID, _ := strconv.ParseInt(utils.GetUserIDFromContext(r), 10, 64)
+    reactions := loadReactions("group_comment", ids, viewerID)
+    mentions := loadMentions("group_comment", ids)
+    for i, c := range out {
+        summary := reactions[ids[i]]
+        c["reactions"] = summary.Reactions
+        c["mentions"] = mentions[ids[i]]
+        if summary.MyReaction != "" {
+            c["my_reaction"] = summary.MyReaction
+        }
     }
     utils.JSON(w, http.StatusOK, out)
 }
@@ -0,0 +1,304 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"social-network/backend/config"
+	"social-network/backend/db"
+	"social-network/backend/models"
+	"social-network/backend/utils"
+)
+
+// Registration modes, see config.RegistrationMode.
+const (
+	RegistrationOpen   = "open"
+	RegistrationInvite = "invite"
+	RegistrationDomain = "domain"
+)
+
+const (
+	defaultInviteDays     = 7
+	maxInviteDays         = 90
+	maxMemberInviteUses   = 10
+	maxAdminInviteUses    = 1000
+	maxActiveMemberInvite = 20
+)
+
+var errInviteInvalid = errors.New("invalid or expired invite code")
+
+// emailDomainAllowed reports whether the email's domain is in config.RegistrationDomains.
+func emailDomainAllowed(email string) bool {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	domain := strings.ToLower(email[at+1:])
+	for _, d := range config.Current.RegistrationDomains {
+		if strings.TrimPrefix(d, "@") == domain {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRegistration enforces the registration mode for a sign-up and claims
+// one use of the invite code, if one is given. It returns the invite's id (0
+// without one); release it with releaseInvite if the sign-up fails.
+func checkRegistration(w http.ResponseWriter, email, code string) (int64, bool) {
+	code = strings.TrimSpace(code)
+	mode := config.Current.RegistrationMode
+	if code == "" {
+		switch {
+		case mode == RegistrationInvite:
+			utils.Error(w, http.StatusForbidden, "Registration requires an invite code")
+			return 0, false
+		case mode == RegistrationDomain && !emailDomainAllowed(email):
+			utils.Error(w, http.StatusForbidden, "Registration is limited to "+strings.Join(config.Current.RegistrationDomains, ", ")+" addresses")
+			return 0, false
+		}
+		return 0, true
+	}
+	id, err := claimInvite(code)
+	if err != nil {
+		utils.Error(w, http.StatusForbidden, "Invalid or expired invite code")
+		return 0, false
+	}
+	return id, true
+}
+
+// claimInvite takes one use of a valid invite code.
+func claimInvite(code string) (int64, error) {
+	var id int64
+	if err := db.DB.QueryRow("SELECT id FROM invite_codes WHERE code = ?", code).Scan(&id); err != nil {
+		return 0, errInviteInvalid
+	}
+	// the conditions are re-checked in the update so concurrent sign-ups can't overrun max_uses
+	res, err := db.DB.Exec(`UPDATE invite_codes SET uses = uses + 1
+		WHERE id = ? AND uses < max_uses AND revoked_at IS NULL AND expires_at > ?`, id, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return 0, errInviteInvalid
+	}
+	return id, nil
+}
+
+// releaseInvite gives back a use claimed for a sign-up that didn't go through.
+func releaseInvite(id int64) {
+	if id > 0 {
+		db.DB.Exec("UPDATE invite_codes SET uses = uses - 1 WHERE id = ? AND uses > 0", id)
+	}
+}
+
+// GET /api/registration - how sign-up works on this server
+func RegistrationInfoHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	info := map[string]interface{}{
+		"mode":            config.Current.RegistrationMode,
+		"invite_required": config.Current.RegistrationMode == RegistrationInvite,
+	}
+	if config.Current.RegistrationMode == RegistrationDomain {
+		info["domains"] = config.Current.RegistrationDomains
+	}
+	utils.JSON(w, http.StatusOK, info)
+}
+
+// canInvite reports whether the user may mint invite codes.
+func canInvite(userID int64) bool {
+	if HasRole(userID, RoleAdmin) {
+		return true
+	}
+	return config.Current.MemberInvites && IsEmailVerified(userID)
+}
+
+// GET  /api/invites - list invite codes created by the current user (admins: ?all=true for everyone's)
+// POST /api/invites - { max_uses, expires_in_days } mint a new code
+func InvitesHandler(w http.ResponseWriter, r *http.Request) {
+	uid := utils.GetUserIDFromContext(r)
+	if uid == "" {
+		utils.Error(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	userID, _ := strconv.ParseInt(uid, 10, 64)
+
+	switch r.Method {
+	case http.MethodGet:
+		listInvites(w, userID, r.URL.Query().Get("all") == "true" && HasRole(userID, RoleAdmin))
+	case http.MethodPost:
+		createInvite(w, r, userID)
+	default:
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+func listInvites(w http.ResponseWriter, userID int64, all bool) {
+	query := `SELECT id, code, created_by, max_uses, uses, expires_at, revoked_at, created_at FROM invite_codes`
+	var args []interface{}
+	if !all {
+		query += " WHERE created_by = ?"
+		args = append(args, userID)
+	}
+	rows, err := db.DB.Query(query+" ORDER BY id DESC", args...)
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, "Failed to query invites")
+		return
+	}
+	defer rows.Close()
+
+	invites := []models.InviteCode{}
+	byID := map[int64]int{}
+	for rows.Next() {
+		var inv models.InviteCode
+		var createdBy sql.NullInt64
+		var revoked, created sql.NullTime
+		if err := rows.Scan(&inv.ID, &inv.Code, &createdBy, &inv.MaxUses, &inv.Uses, &inv.ExpiresAt, &revoked, &created); err != nil {
+			continue
+		}
+		inv.CreatedBy = createdBy.Int64
+		if revoked.Valid {
+			inv.RevokedAt = &revoked.Time
+		}
+		inv.CreatedAt = created.Time
+		inv.UsedBy = []models.InviteSignup{}
+		byID[inv.ID] = len(invites)
+		invites = append(invites, inv)
+	}
+	rows.Close()
+
+	signupQuery := "SELECT u.invite_id, u.id, u.nickname FROM users u JOIN invite_codes i ON i.id = u.invite_id"
+	if !all {
+		signupQuery += " WHERE i.created_by = ?"
+	}
+	signups, err := db.DB.Query(signupQuery+" ORDER BY u.id", args...)
+	if err == nil {
+		defer signups.Close()
+		for signups.Next() {
+			var inviteID int64
+			var s models.InviteSignup
+			if err := signups.Scan(&inviteID, &s.UserID, &s.Nickname); err != nil {
+				continue
+			}
+			if i, ok := byID[inviteID]; ok {
+				invites[i].UsedBy = append(invites[i].UsedBy, s)
+			}
+		}
+	}
+	utils.JSON(w, http.StatusOK, invites)
+}
+
+func createInvite(w http.ResponseWriter, r *http.Request, userID int64) {
+	if !canInvite(userID) {
+		utils.Error(w, http.StatusForbidden, "You can't create invite codes")
+		return
+	}
+	var payload struct {
+		MaxUses       int `json:"max_uses"`
+		ExpiresInDays int `json:"expires_in_days"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		utils.Error(w, http.StatusBadRequest, "Invalid input")
+		return
+	}
+	isAdmin := HasRole(userID, RoleAdmin)
+	maxUses := maxMemberInviteUses
+	if isAdmin {
+		maxUses = maxAdminInviteUses
+	}
+	if payload.MaxUses == 0 {
+		payload.MaxUses = 1
+	}
+	if payload.MaxUses < 1 || payload.MaxUses > maxUses {
+		utils.Error(w, http.StatusBadRequest, "max_uses must be between 1 and "+strconv.Itoa(maxUses))
+		return
+	}
+	if payload.ExpiresInDays == 0 {
+		payload.ExpiresInDays = defaultInviteDays
+	}
+	if payload.ExpiresInDays < 1 || payload.ExpiresInDays > maxInviteDays {
+		utils.Error(w, http.StatusBadRequest, "expires_in_days must be between 1 and "+strconv.Itoa(maxInviteDays))
+		return
+	}
+
+	now := time.Now()
+	if !isAdmin {
+		var active int
+		db.DB.QueryRow(`SELECT COUNT(1) FROM invite_codes WHERE created_by = ? AND revoked_at IS NULL
+			AND expires_at > ? AND uses < max_uses`, userID, now).Scan(&active)
+		if active >= maxActiveMemberInvite {
+			utils.Error(w, http.StatusConflict, "Too many active invites; revoke one first")
+			return
+		}
+	}
+
+	token, err := utils.NewToken()
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, "Server error")
+		return
+	}
+	inv := models.InviteCode{
+		Code:      token[:16],
+		CreatedBy: userID,
+		MaxUses:   payload.MaxUses,
+		ExpiresAt: now.Add(time.Duration(payload.ExpiresInDays) * 24 * time.Hour),
+		CreatedAt: now,
+		UsedBy:    []models.InviteSignup{},
+	}
+	res, err := db.DB.Exec("INSERT INTO invite_codes (code, created_by, max_uses, expires_at, created_at) VALUES (?, ?, ?, ?, ?)",
+		inv.Code, userID, inv.MaxUses, inv.ExpiresAt, now)
+	if err != nil {
+		log.Printf("Failed to create invite for user %d: %v", userID, err)
+		utils.Error(w, http.StatusInternalServerError, "Failed to create invite")
+		return
+	}
+	inv.ID, _ = res.LastInsertId()
+	Audit(r, "invite.create", userID, userID, map[string]interface{}{"invite_id": inv.ID, "max_uses": inv.MaxUses})
+	utils.JSON(w, http.StatusCreated, inv)
+}
+
+// POST /api/invites/revoke - { invite_id } (the creator, or any admin)
+func RevokeInviteHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	uid := utils.GetUserIDFromContext(r)
+	if uid == "" {
+		utils.Error(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	userID, _ := strconv.ParseInt(uid, 10, 64)
+
+	var payload struct {
+		InviteID int64 `json:"invite_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.InviteID <= 0 {
+		utils.Error(w, http.StatusBadRequest, "Invalid input")
+		return
+	}
+	var createdBy sql.NullInt64
+	if err := db.DB.QueryRow("SELECT created_by FROM invite_codes WHERE id = ?", payload.InviteID).Scan(&createdBy); err != nil {
+		utils.Error(w, http.StatusNotFound, "Invite not found")
+		return
+	}
+	if createdBy.Int64 != userID && !HasRole(userID, RoleAdmin) {
+		utils.Error(w, http.StatusNotFound, "Invite not found")
+		return
+	}
+	if _, err := db.DB.Exec("UPDATE invite_codes SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL", time.Now(), payload.InviteID); err != nil {
+		utils.Error(w, http.StatusInternalServerError, "Failed to revoke invite")
+		return
+	}
+	Audit(r, "invite.revoke", createdBy.Int64, userID, map[string]interface{}{"invite_id": payload.InviteID})
+	utils.JSON(w, http.StatusOK, map[string]string{"status": "revoked"})
+}
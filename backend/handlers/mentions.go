@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"social-network/backend/db"
+	"social-network/backend/models"
+)
+
+// Mentions: an @nickname in a post, comment, group post, group comment,
+// direct message or group message is resolved to its user when the content
+// is saved and stored in mentions with its position. Responses carry them as
+// "mentions". Mentioned users get a "mention" notification, but only if they
+// can see the content, and only once per item however often it is edited.
+
+// mentionPattern matches an @ and a nickname. Whatever precedes the @ is
+// checked separately, so e-mail addresses don't count.
+var mentionPattern = regexp.MustCompile(`@([\p{L}\p{N}_.\-]+)`)
+
+// maxMentions caps the distinct users one item can mention.
+const maxMentions = 50
+
+// MentionTarget is an item that can contain mentions.
+type MentionTarget struct {
+	Type string // post, comment, group_post, group_comment, message or group_message
+	ID   int64
+	URL  string // link for the notification
+	// canSee reports whether a mentioned user may see the item.
+	canSee func(userID int64) bool
+}
+
+func postMentionTarget(postID int64) MentionTarget {
+	return MentionTarget{"post", postID, fmt.Sprintf("/posts/%d", postID), func(userID int64) bool {
+		ok, err := CanViewPost(userID, postID)
+		return err == nil && ok
+	}}
+}
+
+func commentMentionTarget(commentID, postID int64) MentionTarget {
+	t := postMentionTarget(postID)
+	t.Type, t.ID = "comment", commentID
+	return t
+}
+
+func groupMentionTarget(targetType string, id, groupID int64) MentionTarget {
+	return MentionTarget{targetType, id, fmt.Sprintf("/groups/%d", groupID), func(userID int64) bool {
+		return isGroupMember(groupID, userID)
+	}}
+}
+
+// MessageMentionTarget is a direct message; only its receiver is told about mentions.
+func MessageMentionTarget(messageID, receiverID int64) MentionTarget {
+	return MentionTarget{"message", messageID, "/chat", func(userID int64) bool {
+		return userID == receiverID
+	}}
+}
+
+// GroupMessageMentionTarget is a group chat message, seen by the group's members.
+func GroupMessageMentionTarget(messageID, groupID int64) MentionTarget {
+	return groupMentionTarget("group_message", messageID, groupID)
+}
+
+func isGroupMember(groupID, userID int64) bool {
+	var n int
+	db.DB.QueryRow("SELECT COUNT(1) FROM group_members WHERE group_id = ? AND user_id = ?", groupID, userID).Scan(&n)
+	return n > 0
+}
+
+// parseMentions finds the @nicknames in content that belong to a user.
+func parseMentions(content string) []models.Mention {
+	type match struct {
+		name       string
+		start, end int // byte offsets of @name
+	}
+	var matches []match
+	names := map[string]bool{}
+	for _, loc := range mentionPattern.FindAllStringSubmatchIndex(content, -1) {
+		if prev, _ := utf8.DecodeLastRuneInString(content[:loc[0]]); loc[0] > 0 &&
+			(unicode.IsLetter(prev) || unicode.IsDigit(prev) || prev == '_') {
+			continue
+		}
+		// trailing dots and dashes are punctuation, as in "thanks @bob."
+		name := strings.TrimRight(content[loc[2]:loc[3]], ".-")
+		if name == "" {
+			continue
+		}
+		if !names[name] && len(names) == maxMentions {
+			continue
+		}
+		names[name] = true
+		matches = append(matches, match{name, loc[0], loc[2] + len(name)})
+	}
+	if len(matches) == 0 {
+		return []models.Mention{}
+	}
+
+	args := make([]interface{}, 0, len(names))
+	for name := range names {
+		args = append(args, name)
+	}
+	ids := map[string]int64{}
+	rows, err := db.DB.Query("SELECT id, nickname FROM users WHERE nickname IN (?"+strings.Repeat(", ?", len(args)-1)+")", args...)
+	if err != nil {
+		log.Printf("Failed to resolve mentions: %v", err)
+		return []models.Mention{}
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var nickname string
+		if rows.Scan(&id, &nickname) == nil {
+			ids[nickname] = id
+		}
+	}
+
+	out := []models.Mention{}
+	for _, m := range matches {
+		if id, ok := ids[m.name]; ok {
+			start := utf16Len(content[:m.start])
+			out = append(out, models.Mention{UserID: id, Nickname: m.name, Start: start, End: start + utf16Len(content[m.start:m.end])})
+		}
+	}
+	return out
+}
+
+// utf16Len is the length of s in UTF-16 code units.
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16.RuneLen(r)
+	}
+	return n
+}
+
+// SaveMentions replaces the stored mentions of t with those in content,
+// written by actorID, and notifies mentioned users who can see t and haven't
+// been told about it yet. It returns the mentions for the response.
+func SaveMentions(t MentionTarget, content string, actorID int64) []models.Mention {
+	mentions := parseMentions(content)
+
+	notified := map[int64]time.Time{}
+	rows, err := db.DB.Query("SELECT user_id, notified_at FROM mentions WHERE target_type = ? AND target_id = ? AND notified_at IS NOT NULL", t.Type, t.ID)
+	if err == nil {
+		for rows.Next() {
+			var userID int64
+			var at time.Time
+			if rows.Scan(&userID, &at) == nil {
+				notified[userID] = at
+			}
+		}
+		rows.Close()
+	}
+	now := time.Now()
+	var notify []int64
+	for _, m := range mentions {
+		if _, done := notified[m.UserID]; done || m.UserID == actorID || !t.canSee(m.UserID) {
+			continue
+		}
+		notified[m.UserID] = now
+		notify = append(notify, m.UserID)
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Failed to save mentions of %s %d: %v", t.Type, t.ID, err)
+		return mentions
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("DELETE FROM mentions WHERE target_type = ? AND target_id = ?", t.Type, t.ID); err != nil {
+		log.Printf("Failed to save mentions of %s %d: %v", t.Type, t.ID, err)
+		return mentions
+	}
+	for _, m := range mentions {
+		var at interface{}
+		if when, ok := notified[m.UserID]; ok {
+			at = when
+		}
+		if _, err := tx.Exec("INSERT INTO mentions (target_type, target_id, user_id, span_start, span_end, notified_at) VALUES (?, ?, ?, ?, ?, ?)",
+			t.Type, t.ID, m.UserID, m.Start, m.End, at); err != nil {
+			log.Printf("Failed to save mentions of %s %d: %v", t.Type, t.ID, err)
+			return mentions
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Failed to save mentions of %s %d: %v", t.Type, t.ID, err)
+		return mentions
+	}
+
+	for _, userID := range notify {
+		_ = Notify(userID, actorID, "mention", map[string]interface{}{
+			"target_type": t.Type,
+			"target_id":   t.ID,
+			"url":         t.URL,
+		})
+	}
+	return mentions
+}
+
+// loadMentions returns the stored mentions of the given items in one
+// query, keyed by id, in the order they appear.
+func loadMentions(targetType string, ids []int64) map[int64][]models.Mention {
+	out := make(map[int64][]models.Mention, len(ids))
+	for _, id := range ids {
+		out[id] = []models.Mention{}
+	}
+	if len(ids) == 0 {
+		return out
+	}
+	args := []interface{}{targetType}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	rows, err := db.DB.Query(`SELECT m.target_id, m.user_id, u.nickname, m.span_start, m.span_end FROM mentions m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.target_type = ? AND m.target_id IN (?`+strings.Repeat(", ?", len(ids)-1)+`)
+		ORDER BY m.target_id, m.span_start`, args...)
+	if err != nil {
+		log.Printf("Failed to load %s mentions: %v", targetType, err)
+		return out
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var m models.Mention
+		if err := rows.Scan(&id, &m.UserID, &m.Nickname, &m.Start, &m.End); err != nil {
+			continue
+		}
+		out[id] = append(out[id], m)
+	}
+	return out
+}
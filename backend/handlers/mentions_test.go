@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"social-network/backend/db"
+	"social-network/backend/models"
+)
+
+func TestParseMentions(t *testing.T) {
+	setupVisibilityDB(t)
+	cases := []struct {
+		content string
+		want    []models.Mention
+	}{
+		{"hi @follower", []models.Mention{{UserID: follower, Nickname: "follower", Start: 3, End: 12}}},
+		{"thanks @picked.", []models.Mention{{UserID: picked, Nickname: "picked", Start: 7, End: 14}}},
+		// offsets count UTF-16 units, so the emoji is two
+		{"😀 @stranger", []models.Mention{{UserID: stranger, Nickname: "stranger", Start: 3, End: 12}}},
+		{"@author and @author", []models.Mention{
+			{UserID: author, Nickname: "author", Start: 0, End: 7},
+			{UserID: author, Nickname: "author", Start: 12, End: 19},
+		}},
+		{"mail me at me@follower", []models.Mention{}},
+		{"@nobody", []models.Mention{}},
+	}
+	for _, tc := range cases {
+		if got := parseMentions(tc.content); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("parseMentions(%q) = %+v, want %+v", tc.content, got, tc.want)
+		}
+	}
+}
+
+// mentioned returns who got a mention notification, in id order.
+func mentioned(t *testing.T) []int64 {
+	t.Helper()
+	rows, err := db.DB.Query("SELECT recipient_id FROM notifications WHERE type = 'mention' ORDER BY recipient_id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		rows.Scan(&id)
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func TestMentionsOnlyNotifyViewers(t *testing.T) {
+	const everyone = "@author @follower @picked @stranger"
+	for _, privacy := range []string{"public", "followers", "private"} {
+		t.Run(privacy, func(t *testing.T) {
+			setupVisibilityDB(t)
+			body := `{"content": "` + everyone + `", "privacy": "` + privacy + `", "allowed": "` + strconv.FormatInt(picked, 10) + `"}`
+			rec := httptest.NewRecorder()
+			CreatePostHandler(rec, asUser(httptest.NewRequest(http.MethodPost, "/api/posts/create", strings.NewReader(body)), author))
+			if rec.Code != http.StatusCreated {
+				t.Fatalf("status %d: %s", rec.Code, rec.Body)
+			}
+
+			// everyone who can see a post like the seeded one, except its author
+			want := []int64{}
+			for _, tc := range visibilityCases {
+				if tc.want && tc.viewer != author && tc.viewer != anonymous && strings.HasPrefix(tc.name, privacy+"/") {
+					want = append(want, tc.viewer)
+				}
+			}
+			sort.Slice(want, func(i, j int) bool { return want[i] < want[j] })
+			if got := mentioned(t); !reflect.DeepEqual(got, want) {
+				t.Errorf("notified %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestMentionNotifiedOnceAcrossEdits(t *testing.T) {
+	setupVisibilityDB(t)
+	target := postMentionTarget(followersPost)
+	SaveMentions(target, "@stranger @follower", author)
+	SaveMentions(target, "still @follower and @stranger", author)
+	if got := mentioned(t); !reflect.DeepEqual(got, []int64{follower}) {
+		t.Fatalf("notified %v, want only the follower", got)
+	}
+
+	// once the post is public the stranger may see it, and hears about it
+	db.DB.Exec("UPDATE posts SET privacy = 'public' WHERE id = ?", followersPost)
+	SaveMentions(target, "still @follower and @stranger", author)
+	if got := mentioned(t); !reflect.DeepEqual(got, []int64{follower, stranger}) {
+		t.Errorf("notified %v, want follower and stranger once each", got)
+	}
+}
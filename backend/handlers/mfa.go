@@ -0,0 +1,381 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"social-network/backend/config"
+	"social-network/backend/db"
+	"social-network/backend/ratelimit"
+	"social-network/backend/utils"
+)
+
+const (
+	// maxMFAAttempts is how many wrong codes a login challenge tolerates before it is discarded.
+	maxMFAAttempts = 5
+	// recoveryCodeCount is how many one-time recovery codes are issued at a time.
+	recoveryCodeCount = 10
+)
+
+// mfaUserRule limits second-factor attempts per account, across challenges
+// and client addresses, so fresh challenges can't be used to keep guessing.
+var mfaUserRule = ratelimit.Rule{Burst: 10, Every: time.Minute}
+
+// loadTOTP returns the user's TOTP secret and whether 2FA is switched on.
+func loadTOTP(userID int64) (secret string, enabled bool, err error) {
+	var s sql.NullString
+	var e int
+	err = db.DB.QueryRow("SELECT totp_secret, IFNULL(totp_enabled, 0) FROM users WHERE id = ?", userID).Scan(&s, &e)
+	return s.String, e == 1, err
+}
+
+// verifyTOTP checks a code against the user's secret and records the matched
+// time step, so the same code can't be replayed within its validity window.
+func verifyTOTP(userID int64, secret, code string) bool {
+	step, ok := utils.ValidateTOTP(secret, code, time.Now())
+	if !ok {
+		return false
+	}
+	res, err := db.DB.Exec("UPDATE users SET totp_last_step = ? WHERE id = ? AND IFNULL(totp_last_step, 0) < ?", step, userID, step)
+	if err != nil {
+		return false
+	}
+	n, _ := res.RowsAffected()
+	return n > 0
+}
+
+// useRecoveryCode consumes one of the user's unused recovery codes.
+func useRecoveryCode(userID int64, code string) bool {
+	res, err := db.DB.Exec("UPDATE mfa_recovery_codes SET used_at = ? WHERE user_id = ? AND code_hash = ? AND used_at IS NULL",
+		time.Now(), userID, utils.HashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return false
+	}
+	n, _ := res.RowsAffected()
+	return n > 0
+}
+
+// checkSecondFactor accepts either a current TOTP code or an unused recovery code.
+func checkSecondFactor(userID int64, secret, code, recoveryCode string) bool {
+	if code != "" {
+		return verifyTOTP(userID, secret, code)
+	}
+	if recoveryCode != "" {
+		return useRecoveryCode(userID, recoveryCode)
+	}
+	return false
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+}
+
+// issueRecoveryCodes replaces the user's recovery codes and returns the new
+// plaintext codes. Only their hashes are stored.
+func issueRecoveryCodes(userID int64) ([]string, error) {
+	enc := base32.StdEncoding.WithPadding(base32.NoPadding)
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		raw := strings.ToLower(enc.EncodeToString(b))[:10]
+		codes = append(codes, raw[:5]+"-"+raw[5:])
+		hashes = append(hashes, utils.HashToken(raw))
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("DELETE FROM mfa_recovery_codes WHERE user_id = ?", userID); err != nil {
+		return nil, err
+	}
+	for _, h := range hashes {
+		if _, err := tx.Exec("INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES (?, ?)", userID, h); err != nil {
+			return nil, err
+		}
+	}
+	return codes, tx.Commit()
+}
+
+// issueMFAChallenge records a pending login for a user whose password was
+// correct and returns the opaque challenge token the client must send back.
+func issueMFAChallenge(userID int64) (string, error) {
+	token, err := utils.NewToken()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	// drop this user's stale challenges while we're here
+	db.DB.Exec("DELETE FROM mfa_challenges WHERE user_id = ? AND expires_at < ?", userID, now)
+	_, err = db.DB.Exec("INSERT INTO mfa_challenges (user_id, token_hash, expires_at) VALUES (?, ?, ?)",
+		userID, utils.HashToken(token), now.Add(config.Current.MFAChallengeTTL))
+	return token, err
+}
+
+// POST /login/mfa - { challenge, code } or { challenge, recovery_code }
+// Second step of the login flow for accounts with 2FA enabled.
+func LoginMFAHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	var payload struct {
+		Challenge    string `json:"challenge"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.Challenge == "" {
+		utils.Error(w, http.StatusBadRequest, "Invalid input")
+		return
+	}
+
+	userID, ok := completeMFAChallenge(w, r, payload.Challenge, payload.Code, payload.RecoveryCode)
+	if !ok {
+		return
+	}
+	finishLogin(w, r, userID)
+}
+
+// completeMFAChallenge checks the second factor for a pending login challenge
+// and consumes the challenge on success. On failure it has already written
+// the error response.
+func completeMFAChallenge(w http.ResponseWriter, r *http.Request, challenge, code, recoveryCode string) (int64, bool) {
+	var challengeID, userID int64
+	var expiresAt time.Time
+	var attempts int
+	err := db.DB.QueryRow("SELECT id, user_id, expires_at, IFNULL(attempts, 0) FROM mfa_challenges WHERE token_hash = ?",
+		utils.HashToken(challenge)).Scan(&challengeID, &userID, &expiresAt, &attempts)
+	if err != nil || time.Now().After(expiresAt) || attempts >= maxMFAAttempts {
+		utils.Error(w, http.StatusUnauthorized, "Login challenge expired, please sign in again")
+		return 0, false
+	}
+	if ok, wait := ratelimit.Default().Allow("mfa:user:"+strconv.FormatInt(userID, 10), mfaUserRule); !ok {
+		utils.TooManyRequests(w, wait)
+		return 0, false
+	}
+
+	secret, enabled, err := loadTOTP(userID)
+	if err != nil || !enabled {
+		utils.Error(w, http.StatusUnauthorized, "Login challenge expired, please sign in again")
+		return 0, false
+	}
+	if !checkSecondFactor(userID, secret, code, recoveryCode) {
+		db.DB.Exec("UPDATE mfa_challenges SET attempts = IFNULL(attempts, 0) + 1 WHERE id = ?", challengeID)
+		Audit(r, "login.failure", userID, userID, map[string]interface{}{"reason": "second_factor"})
+		utils.Error(w, http.StatusUnauthorized, "Invalid code")
+		return 0, false
+	}
+
+	db.DB.Exec("DELETE FROM mfa_challenges WHERE id = ?", challengeID)
+	return userID, true
+}
+
+// GET /api/mfa - 2FA status for the current user
+func MFAStatusHandler(w http.ResponseWriter, r *http.Request) {
+	uid := utils.GetUserIDFromContext(r)
+	if uid == "" {
+		utils.Error(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	userID, _ := strconv.ParseInt(uid, 10, 64)
+	_, enabled, err := loadTOTP(userID)
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, "Failed to load 2FA status")
+		return
+	}
+	var remaining int
+	db.DB.QueryRow("SELECT COUNT(1) FROM mfa_recovery_codes WHERE user_id = ? AND used_at IS NULL", userID).Scan(&remaining)
+	utils.JSON(w, http.StatusOK, map[string]interface{}{"enabled": enabled, "recovery_codes_remaining": remaining})
+}
+
+// POST /api/mfa/enroll - start 2FA enrollment; returns the secret and otpauth:// URI
+func EnrollMFAHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	uid := utils.GetUserIDFromContext(r)
+	if uid == "" {
+		utils.Error(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	userID, _ := strconv.ParseInt(uid, 10, 64)
+
+	_, enabled, err := loadTOTP(userID)
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, "Server error")
+		return
+	}
+	if enabled {
+		utils.Error(w, http.StatusConflict, "Two-factor authentication is already enabled")
+		return
+	}
+
+	var email string
+	db.DB.QueryRow("SELECT email FROM users WHERE id = ?", userID).Scan(&email)
+	secret, err := utils.NewTOTPSecret()
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, "Server error")
+		return
+	}
+	// stored but inactive until confirmed with a first code
+	if _, err := db.DB.Exec("UPDATE users SET totp_secret = ?, totp_enabled = 0, totp_last_step = 0 WHERE id = ?", secret, userID); err != nil {
+		log.Printf("TOTP enroll error for user %d: %v", userID, err)
+		utils.Error(w, http.StatusInternalServerError, "Failed to start enrollment")
+		return
+	}
+	utils.JSON(w, http.StatusOK, map[string]string{
+		"secret":      secret,
+		"otpauth_uri": utils.TOTPURI(secret, config.Current.TOTPIssuer, email),
+	})
+}
+
+// POST /api/mfa/confirm - { code }; activates 2FA and returns the recovery codes (shown once)
+func ConfirmMFAHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	uid := utils.GetUserIDFromContext(r)
+	if uid == "" {
+		utils.Error(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	userID, _ := strconv.ParseInt(uid, 10, 64)
+	var payload struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.Code == "" {
+		utils.Error(w, http.StatusBadRequest, "Invalid input")
+		return
+	}
+
+	secret, enabled, err := loadTOTP(userID)
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, "Server error")
+		return
+	}
+	if enabled {
+		utils.Error(w, http.StatusConflict, "Two-factor authentication is already enabled")
+		return
+	}
+	if secret == "" {
+		utils.Error(w, http.StatusBadRequest, "Start enrollment first")
+		return
+	}
+	if !verifyTOTP(userID, secret, payload.Code) {
+		utils.Error(w, http.StatusBadRequest, "Invalid code")
+		return
+	}
+
+	codes, err := issueRecoveryCodes(userID)
+	if err != nil {
+		log.Printf("Recovery code generation error for user %d: %v", userID, err)
+		utils.Error(w, http.StatusInternalServerError, "Failed to enable two-factor authentication")
+		return
+	}
+	if _, err := db.DB.Exec("UPDATE users SET totp_enabled = 1 WHERE id = ?", userID); err != nil {
+		utils.Error(w, http.StatusInternalServerError, "Failed to enable two-factor authentication")
+		return
+	}
+	Audit(r, "mfa.enable", userID, userID, nil)
+	utils.JSON(w, http.StatusOK, map[string]interface{}{"status": "enabled", "recovery_codes": codes})
+}
+
+// POST /api/mfa/disable - { password, code | recovery_code }
+func DisableMFAHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	uid := utils.GetUserIDFromContext(r)
+	if uid == "" {
+		utils.Error(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	userID, _ := strconv.ParseInt(uid, 10, 64)
+	var payload struct {
+		Password     string `json:"password"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.Password == "" {
+		utils.Error(w, http.StatusBadRequest, "Invalid input")
+		return
+	}
+
+	var hashed string
+	if err := db.DB.QueryRow("SELECT password FROM users WHERE id = ?", userID).Scan(&hashed); err != nil || !utils.CheckPassword(hashed, payload.Password) {
+		utils.Error(w, http.StatusUnauthorized, "Invalid credentials")
+		return
+	}
+	secret, enabled, err := loadTOTP(userID)
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, "Server error")
+		return
+	}
+	if !enabled {
+		utils.Error(w, http.StatusBadRequest, "Two-factor authentication is not enabled")
+		return
+	}
+	if !checkSecondFactor(userID, secret, payload.Code, payload.RecoveryCode) {
+		utils.Error(w, http.StatusUnauthorized, "Invalid code")
+		return
+	}
+
+	db.DB.Exec("DELETE FROM mfa_recovery_codes WHERE user_id = ?", userID)
+	if _, err := db.DB.Exec("UPDATE users SET totp_secret = NULL, totp_enabled = 0, totp_last_step = 0 WHERE id = ?", userID); err != nil {
+		utils.Error(w, http.StatusInternalServerError, "Failed to disable two-factor authentication")
+		return
+	}
+	Audit(r, "mfa.disable", userID, userID, nil)
+	utils.JSON(w, http.StatusOK, map[string]string{"status": "disabled"})
+}
+
+// POST /api/mfa/recovery-codes - { code }; replaces all recovery codes with a fresh set
+func RegenerateRecoveryCodesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	uid := utils.GetUserIDFromContext(r)
+	if uid == "" {
+		utils.Error(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	userID, _ := strconv.ParseInt(uid, 10, 64)
+	var payload struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.Code == "" {
+		utils.Error(w, http.StatusBadRequest, "Invalid input")
+		return
+	}
+	secret, enabled, err := loadTOTP(userID)
+	if err != nil || !enabled {
+		utils.Error(w, http.StatusBadRequest, "Two-factor authentication is not enabled")
+		return
+	}
+	if !verifyTOTP(userID, secret, payload.Code) {
+		utils.Error(w, http.StatusUnauthorized, "Invalid code")
+		return
+	}
+	codes, err := issueRecoveryCodes(userID)
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, "Failed to generate recovery codes")
+		return
+	}
+	utils.JSON(w, http.StatusOK, map[string]interface{}{"recovery_codes": codes})
+}
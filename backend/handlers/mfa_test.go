@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"social-network/backend/db"
+	"social-network/backend/ratelimit"
+	"social-network/backend/utils"
+)
+
+// useFreshLimiter gives the test its own in-memory rate limiter.
+func useFreshLimiter(t *testing.T) {
+	t.Helper()
+	prev := ratelimit.Default()
+	ratelimit.Set(ratelimit.New(ratelimit.NewMemoryStore(), ratelimit.LockoutPolicy{MaxFailures: 5, Window: time.Minute, Base: time.Second, Max: time.Minute}))
+	t.Cleanup(func() { ratelimit.Set(prev) })
+}
+
+func TestMFAAttemptsLimitedPerUser(t *testing.T) {
+	setupTestDB(t)
+	useFreshLimiter(t)
+	if _, err := db.DB.Exec(`INSERT INTO users (id, email, password, first_name, last_name, nickname, totp_secret, totp_enabled)
+		VALUES (1, 'mfa@example.com', 'x', 'M', 'F', 'mfa', 'JBSWY3DPEHPK3PXP', 1)`); err != nil {
+		t.Fatal(err)
+	}
+
+	// every attempt uses a fresh challenge, as an attacker with the password could
+	for i := 1; i <= mfaUserRule.Burst+1; i++ {
+		challenge := fmt.Sprintf("challenge-%d", i)
+		db.DB.Exec("INSERT INTO mfa_challenges (user_id, token_hash, expires_at) VALUES (1, ?, ?)",
+			utils.HashToken(challenge), time.Now().Add(time.Minute))
+		body := `{"challenge": "` + challenge + `", "code": "000000"}`
+		req := httptest.NewRequest(http.MethodPost, "/login/mfa", strings.NewReader(body))
+		req.RemoteAddr = fmt.Sprintf("203.0.113.%d:1000", i) // and a fresh address
+		rec := httptest.NewRecorder()
+		LoginMFAHandler(rec, req)
+
+		want := http.StatusUnauthorized
+		if i > mfaUserRule.Burst {
+			want = http.StatusTooManyRequests
+		}
+		if rec.Code != want {
+			t.Fatalf("attempt %d: status %d, want %d", i, rec.Code, want)
+		}
+	}
+}
+
+// totpCode computes the RFC 6238 code for secret at t, independently of utils.
+func totpCode(t *testing.T, secret string, at time.Time) string {
+	t.Helper()
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(at.Unix()/30))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	return fmt.Sprintf("%06d", (binary.BigEndian.Uint32(sum[offset:])&0x7fffffff)%1000000)
+}
+
+func TestTOTPCodesCantBeReplayed(t *testing.T) {
+	const secret = "JBSWY3DPEHPK3PXP"
+	now := time.Now()
+	cases := []struct {
+		name     string
+		lastStep int64 // totp_last_step before the attempt, relative to now's step
+		code     string
+		want     bool
+	}{
+		{"fresh code", -5, totpCode(t, secret, now), true},
+		{"code already used", 0, totpCode(t, secret, now), false},
+		{"older than the last used code", 0, totpCode(t, secret, now.Add(-30*time.Second)), false},
+		{"newer than the last used code", -1, totpCode(t, secret, now), true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			setupTestDB(t)
+			if _, err := db.DB.Exec(`INSERT INTO users (id, email, password, first_name, last_name, nickname, totp_secret, totp_enabled, totp_last_step)
+				VALUES (1, 'mfa@example.com', 'x', 'M', 'F', 'mfa', ?, 1, ?)`, secret, now.Unix()/30+tc.lastStep); err != nil {
+				t.Fatal(err)
+			}
+			if got := verifyTOTP(1, secret, tc.code); got != tc.want {
+				t.Errorf("verifyTOTP = %v, want %v", got, tc.want)
+			}
+		})
+	}
+
+	// a code that got in can't be used a second time
+	setupTestDB(t)
+	db.DB.Exec(`INSERT INTO users (id, email, password, first_name, last_name, nickname, totp_secret, totp_enabled)
+		VALUES (1, 'mfa@example.com', 'x', 'M', 'F', 'mfa', ?, 1)`, secret)
+	code := totpCode(t, secret, time.Now())
+	if !verifyTOTP(1, secret, code) {
+		t.Fatal("first use rejected")
+	}
+	if verifyTOTP(1, secret, code) {
+		t.Error("replayed code accepted")
+	}
+}
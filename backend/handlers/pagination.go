@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+var errBadCursor = errors.New("invalid cursor")
+
+// feedCursor points at the last item of a page. Pages are ordered by
+// (created_at, id), descending for feeds and ascending for replies, so a
+// cursor keeps working when newer items are added.
+type feedCursor struct {
+	CreatedAt string // as stored in the database
+	ID        int64
+}
+
+// String encodes the cursor. Clients must treat it as opaque.
+func (c feedCursor) String() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(c.CreatedAt + "|" + strconv.FormatInt(c.ID, 10)))
+}
+
+func parseFeedCursor(s string) (*feedCursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errBadCursor
+	}
+	at, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return nil, errBadCursor
+	}
+	n, err := strconv.ParseInt(id, 10, 64)
+	if err != nil || n <= 0 || at == "" {
+		return nil, errBadCursor
+	}
+	return &feedCursor{CreatedAt: at, ID: n}, nil
+}
+
+// pageLimit reads ?limit=, falling back to the default page size.
+func pageLimit(r *http.Request) int {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 {
+		return defaultPageSize
+	}
+	if limit > maxPageSize {
+		return maxPageSize
+	}
+	return limit
+}
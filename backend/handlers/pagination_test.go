@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"social-network/backend/db"
+)
+
+func TestFeedCursorSurvivesNewPosts(t *testing.T) {
+	setupVisibilityDB(t)
+	// posts 1-7, all from the same second, so only the id breaks ties
+	if _, err := db.DB.Exec(`INSERT INTO posts (id, author_id, content, privacy) VALUES
+		(4, 1, 'four', 'public'), (5, 1, 'five', 'public'), (6, 1, 'six', 'public'), (7, 1, 'seven', 'public')`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.DB.Exec("UPDATE posts SET created_at = '2026-01-01 12:00:00'"); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []int64
+	cursor := ""
+	for page := 0; page < 10; page++ {
+		rec := httptest.NewRecorder()
+		ListFeedHandler(rec, asUser(httptest.NewRequest(http.MethodGet, "/api/posts?user_id=1&limit=3&cursor="+cursor, nil), author))
+		var resp struct {
+			Posts      []feedPost `json:"posts"`
+			NextCursor *string    `json:"next_cursor"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("page %d: status %d: %v", page, rec.Code, err)
+		}
+		for _, p := range resp.Posts {
+			got = append(got, p.ID)
+		}
+		if resp.NextCursor == nil {
+			break
+		}
+		cursor = *resp.NextCursor
+		if page == 0 {
+			// posted while the client is paging, in the same second as the rest
+			if _, err := db.DB.Exec("INSERT INTO posts (id, author_id, content, privacy, created_at) VALUES (8, 1, 'eight', 'public', '2026-01-01 12:00:00')"); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if want := []int64{7, 6, 5, 4, 3, 2, 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("paged through %v, want %v", got, want)
+	}
+
+	rec := httptest.NewRecorder()
+	ListFeedHandler(rec, httptest.NewRequest(http.MethodGet, "/api/posts?cursor=not-a-cursor", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("bad cursor: status %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"social-network/backend/config"
+	"social-network/backend/db"
+	"social-network/backend/mailer"
+	"social-network/backend/utils"
+)
+
+// minPasswordLength is the shortest password accepted when a password is (re)set.
+const minPasswordLength = 8
+
+// POST /api/password/forgot - { email }
+// Always answers with the same message so the endpoint can't be used to probe
+// which addresses are registered.
+func ForgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	var payload struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || strings.TrimSpace(payload.Email) == "" {
+		utils.Error(w, http.StatusBadRequest, "Invalid input")
+		return
+	}
+	email := strings.ToLower(strings.TrimSpace(payload.Email))
+	resp := map[string]string{"message": "If an account exists for that email, a reset link has been sent"}
+
+	var userID int64
+	err := db.DB.QueryRow("SELECT id FROM users WHERE email = ?", email).Scan(&userID)
+	if err == sql.ErrNoRows {
+		utils.JSON(w, http.StatusOK, resp)
+		return
+	} else if err != nil {
+		log.Printf("Forgot password lookup error: %v", err)
+		utils.Error(w, http.StatusInternalServerError, "Server error")
+		return
+	}
+
+	token, err := utils.NewToken()
+	if err != nil {
+		log.Printf("Reset token generation error: %v", err)
+		utils.Error(w, http.StatusInternalServerError, "Server error")
+		return
+	}
+
+	// only the most recent link is usable
+	now := time.Now()
+	db.DB.Exec("UPDATE password_resets SET used_at = ? WHERE user_id = ? AND used_at IS NULL", now, userID)
+	_, err = db.DB.Exec("INSERT INTO password_resets (user_id, token_hash, expires_at) VALUES (?, ?, ?)",
+		userID, utils.HashToken(token), now.Add(config.Current.PasswordResetTTL))
+	if err != nil {
+		log.Printf("Reset token insert error: %v", err)
+		utils.Error(w, http.StatusInternalServerError, "Server error")
+		return
+	}
+
+	link := fmt.Sprintf("%s/reset-password?token=%s", config.Current.AppBaseURL, url.QueryEscape(token))
+	msg := mailer.Message{
+		To:      email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Someone asked to reset the password for your account.\n\n"+
+			"Open this link to choose a new password (valid for %s):\n%s\n\n"+
+			"If this wasn't you, you can ignore this email.", config.Current.PasswordResetTTL, link),
+	}
+	// send in the background so response timing doesn't reveal whether the account exists
+	go func() {
+		if err := mailer.Send(msg); err != nil {
+			log.Printf("Failed to send password reset email to user %d: %v", userID, err)
+		}
+	}()
+
+	utils.JSON(w, http.StatusOK, resp)
+}
+
+// POST /api/password/reset - { token, password }
+// Consumes a reset token, sets the new password and signs the user out everywhere.
+func ResetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	var payload struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.Token == "" {
+		utils.Error(w, http.StatusBadRequest, "Invalid input")
+		return
+	}
+	if len(payload.Password) < minPasswordLength {
+		utils.Error(w, http.StatusBadRequest, fmt.Sprintf("Password must be at least %d characters", minPasswordLength))
+		return
+	}
+
+	var resetID, userID int64
+	var expiresAt time.Time
+	err := db.DB.QueryRow("SELECT id, user_id, expires_at FROM password_resets WHERE token_hash = ? AND used_at IS NULL",
+		utils.HashToken(payload.Token)).Scan(&resetID, &userID, &expiresAt)
+	if err != nil || time.Now().After(expiresAt) {
+		utils.Error(w, http.StatusBadRequest, "Invalid or expired reset link")
+		return
+	}
+
+	hashed, err := utils.HashPassword(payload.Password)
+	if err != nil {
+		log.Println("Password hash error:", err)
+		utils.Error(w, http.StatusInternalServerError, "Server error")
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, "Server error")
+		return
+	}
+	defer tx.Rollback()
+
+	// claim the token; a concurrent request using the same token loses here
+	res, err := tx.Exec("UPDATE password_resets SET used_at = ? WHERE id = ? AND used_at IS NULL", time.Now(), resetID)
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, "Server error")
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		utils.Error(w, http.StatusBadRequest, "Invalid or expired reset link")
+		return
+	}
+	if _, err := tx.Exec("UPDATE users SET password = ? WHERE id = ?", hashed, userID); err != nil {
+		log.Printf("Password update error for user %d: %v", userID, err)
+		utils.Error(w, http.StatusInternalServerError, "Failed to reset password")
+		return
+	}
+	if _, err := tx.Exec("DELETE FROM sessions WHERE user_id = ?", userID); err != nil {
+		log.Printf("Session wipe error for user %d: %v", userID, err)
+		utils.Error(w, http.StatusInternalServerError, "Failed to reset password")
+		return
+	}
+	// API tokens may have been created by whoever had the account
+	if _, err := tx.Exec("DELETE FROM personal_access_tokens WHERE user_id = ?", userID); err != nil {
+		log.Printf("Token wipe error for user %d: %v", userID, err)
+		utils.Error(w, http.StatusInternalServerError, "Failed to reset password")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		utils.Error(w, http.StatusInternalServerError, "Failed to reset password")
+		return
+	}
+
+	Audit(r, "password.reset", userID, userID, nil)
+	utils.ExpireSessionCookie(w)
+	utils.JSON(w, http.StatusOK, map[string]string{"status": "password_reset"})
+}
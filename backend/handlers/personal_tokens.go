@@ -0,0 +1,252 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"social-network/backend/db"
+	"social-network/backend/models"
+	"social-network/backend/utils"
+)
+
+// PersonalTokenPrefix starts every personal access token, which tells them
+// apart from signed access tokens in the Authorization header.
+const PersonalTokenPrefix = "pat_"
+
+const (
+	defaultTokenLifetimeDays = 30
+	maxTokenLifetimeDays     = 365
+	maxTokensPerUser         = 20
+)
+
+// TokenScopes are the scopes a personal access token can be granted. Routes
+// declare the scope they need in RegisterRoutes; account and security
+// endpoints accept no scope at all, so tokens can never reach them.
+var TokenScopes = []string{
+	"posts:read",
+	"posts:write",
+	"followers:read",
+	"followers:write",
+	"profile:write",
+	"groups:read",
+	"groups:write",
+	"messages:read",
+	"messages:write",
+	"notifications:read",
+	"notifications:write",
+}
+
+func validTokenScope(scope string) bool {
+	for _, s := range TokenScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func tokenScopeGranted(granted []string, scope string) bool {
+	for _, s := range granted {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrTokenScope is returned when a valid token lacks the scope a route requires.
+var ErrTokenScope = errors.New("token lacks required scope")
+
+// AuthenticatePersonalToken checks a personal access token and that it grants
+// scope, recording its use. A scope naming several space-separated scopes
+// needs all of them. It returns the owning user's id.
+func AuthenticatePersonalToken(token, scope string) (int64, error) {
+	var id, userID int64
+	var scopes string
+	var expiresAt time.Time
+	var lastUsed sql.NullTime
+	err := db.DB.QueryRow("SELECT id, user_id, scopes, expires_at, last_used_at FROM personal_access_tokens WHERE token_hash = ?",
+		utils.HashToken(token)).Scan(&id, &userID, &scopes, &expiresAt, &lastUsed)
+	if err != nil {
+		return 0, utils.ErrInvalidToken
+	}
+	now := time.Now()
+	if now.After(expiresAt) {
+		return 0, utils.ErrInvalidToken
+	}
+	granted := strings.Fields(scopes)
+	for _, want := range strings.Fields(scope) {
+		if !tokenScopeGranted(granted, want) {
+			return 0, ErrTokenScope
+		}
+	}
+	// like session last-seen, only rewritten once a minute
+	if !lastUsed.Valid || now.Sub(lastUsed.Time) > time.Minute {
+		db.DB.Exec("UPDATE personal_access_tokens SET last_used_at = ? WHERE id = ?", now, id)
+	}
+	return userID, nil
+}
+
+// GET  /api/tokens - list the current user's personal access tokens
+// POST /api/tokens - { name, scopes, expires_in_days } create one; the token is only shown in this response
+func PersonalTokensHandler(w http.ResponseWriter, r *http.Request) {
+	uid := utils.GetUserIDFromContext(r)
+	if uid == "" {
+		utils.Error(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	userID, _ := strconv.ParseInt(uid, 10, 64)
+
+	switch r.Method {
+	case http.MethodGet:
+		listPersonalTokens(w, userID)
+	case http.MethodPost:
+		createPersonalToken(w, r, userID)
+	default:
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+func listPersonalTokens(w http.ResponseWriter, userID int64) {
+	rows, err := db.DB.Query(`SELECT id, name, token_prefix, scopes, expires_at, last_used_at, created_at
+		FROM personal_access_tokens WHERE user_id = ? ORDER BY id DESC`, userID)
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, "Failed to query tokens")
+		return
+	}
+	defer rows.Close()
+
+	out := []models.PersonalAccessToken{}
+	for rows.Next() {
+		var t models.PersonalAccessToken
+		var scopes string
+		var lastUsed sql.NullTime
+		var created sql.NullTime
+		if err := rows.Scan(&t.ID, &t.Name, &t.Prefix, &scopes, &t.ExpiresAt, &lastUsed, &created); err != nil {
+			continue
+		}
+		t.Scopes = strings.Fields(scopes)
+		if lastUsed.Valid {
+			t.LastUsedAt = &lastUsed.Time
+		}
+		t.CreatedAt = created.Time
+		out = append(out, t)
+	}
+	utils.JSON(w, http.StatusOK, out)
+}
+
+func createPersonalToken(w http.ResponseWriter, r *http.Request, userID int64) {
+	var payload struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays int      `json:"expires_in_days"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		utils.Error(w, http.StatusBadRequest, "Invalid input")
+		return
+	}
+	name := strings.TrimSpace(payload.Name)
+	if name == "" || len(name) > 100 {
+		utils.Error(w, http.StatusBadRequest, "Token name is required (max 100 characters)")
+		return
+	}
+	if len(payload.Scopes) == 0 {
+		utils.Error(w, http.StatusBadRequest, "At least one scope is required")
+		return
+	}
+	seen := map[string]bool{}
+	var scopes []string
+	for _, s := range payload.Scopes {
+		s = strings.ToLower(strings.TrimSpace(s))
+		if !validTokenScope(s) {
+			utils.Error(w, http.StatusBadRequest, "Unknown scope: "+s)
+			return
+		}
+		if !seen[s] {
+			seen[s] = true
+			scopes = append(scopes, s)
+		}
+	}
+	sort.Strings(scopes)
+	days := payload.ExpiresInDays
+	if days == 0 {
+		days = defaultTokenLifetimeDays
+	}
+	if days < 1 || days > maxTokenLifetimeDays {
+		utils.Error(w, http.StatusBadRequest, "expires_in_days must be between 1 and "+strconv.Itoa(maxTokenLifetimeDays))
+		return
+	}
+
+	var count int
+	db.DB.QueryRow("SELECT COUNT(1) FROM personal_access_tokens WHERE user_id = ?", userID).Scan(&count)
+	if count >= maxTokensPerUser {
+		utils.Error(w, http.StatusConflict, "Too many tokens; revoke one first")
+		return
+	}
+
+	secret, err := utils.NewToken()
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, "Server error")
+		return
+	}
+	token := PersonalTokenPrefix + secret
+	now := time.Now()
+	t := models.PersonalAccessToken{
+		Name:      name,
+		Prefix:    token[:len(PersonalTokenPrefix)+8],
+		Scopes:    scopes,
+		ExpiresAt: now.Add(time.Duration(days) * 24 * time.Hour),
+		CreatedAt: now,
+		Token:     token,
+	}
+	res, err := db.DB.Exec(`INSERT INTO personal_access_tokens (user_id, name, token_hash, token_prefix, scopes, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`, userID, t.Name, utils.HashToken(token), t.Prefix, strings.Join(scopes, " "), t.ExpiresAt, now)
+	if err != nil {
+		log.Printf("Failed to create token for user %d: %v", userID, err)
+		utils.Error(w, http.StatusInternalServerError, "Failed to create token")
+		return
+	}
+	t.ID, _ = res.LastInsertId()
+	Audit(r, "pat.create", userID, userID, map[string]interface{}{"token_id": t.ID, "name": t.Name, "scopes": scopes})
+	utils.JSON(w, http.StatusCreated, t)
+}
+
+// POST /api/tokens/revoke - { token_id }
+func RevokePersonalTokenHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	uid := utils.GetUserIDFromContext(r)
+	if uid == "" {
+		utils.Error(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	userID, _ := strconv.ParseInt(uid, 10, 64)
+
+	var payload struct {
+		TokenID int64 `json:"token_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.TokenID <= 0 {
+		utils.Error(w, http.StatusBadRequest, "Invalid input")
+		return
+	}
+	res, err := db.DB.Exec("DELETE FROM personal_access_tokens WHERE id = ? AND user_id = ?", payload.TokenID, userID)
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, "Failed to revoke token")
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		utils.Error(w, http.StatusNotFound, "Token not found")
+		return
+	}
+	Audit(r, "pat.revoke", userID, userID, map[string]interface{}{"token_id": payload.TokenID})
+	utils.JSON(w, http.StatusOK, map[string]string{"status": "revoked"})
+}
@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"social-network/backend/db"
+	"social-network/backend/utils"
+)
+
+// postPrivacies are the valid post privacy settings.
+var postPrivacies = map[string]bool{"public": true, "followers": true, "private": true}
+
+type postRevision struct {
+	ID         int64  `json:"id"`
+	Content    string `json:"content"`
+	ImageURL   string `json:"image_url"`
+	Privacy    string `json:"privacy"`
+	ReplacedAt string `json:"replaced_at"`
+}
+
+// ownPost loads the author and current version of a post, answering 404 or
+// 403 unless it exists and belongs to userID.
+func ownPost(w http.ResponseWriter, postID, userID int64) (content, image, privacy string, ok bool) {
+	var authorID int64
+	var img sql.NullString
+	err := db.DB.QueryRow("SELECT author_id, content, image_url, privacy FROM posts WHERE id = ?", postID).
+		Scan(&authorID, &content, &img, &privacy)
+	if err != nil {
+		utils.Error(w, http.StatusNotFound, "Post not found")
+		return "", "", "", false
+	}
+	if authorID != userID {
+		utils.Error(w, http.StatusForbidden, "You can only change your own posts")
+		return "", "", "", false
+	}
+	return content, img.String, privacy, true
+}
+
+// POST /api/posts/update - { post_id, content, image_url, privacy, allowed }
+// Fields left out keep their value; send an empty image_url to remove the image.
+// The previous version is kept in post_revisions.
+func UpdatePostHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	uid := utils.GetUserIDFromContext(r)
+	if uid == "" {
+		utils.Error(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	userID, _ := strconv.ParseInt(uid, 10, 64)
+
+	var payload struct {
+		PostID   int64   `json:"post_id"`
+		Content  *string `json:"content"`
+		ImageURL *string `json:"image_url"`
+		Privacy  *string `json:"privacy"`
+		Allowed  *string `json:"allowed"` // comma-separated ids of who can see a private post
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.PostID <= 0 {
+		utils.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	oldContent, oldImage, oldPrivacy, ok := ownPost(w, payload.PostID, userID)
+	if !ok {
+		return
+	}
+
+	content, image, privacy := oldContent, oldImage, oldPrivacy
+	if payload.Content != nil {
+		content = *payload.Content
+	}
+	if payload.ImageURL != nil {
+		image = normalizeURL(*payload.ImageURL)
+	}
+	if payload.Privacy != nil {
+		privacy = *payload.Privacy
+	}
+	if content == "" {
+		utils.Error(w, http.StatusBadRequest, "Post content cannot be empty")
+		return
+	}
+	if !postPrivacies[privacy] {
+		utils.Error(w, http.StatusBadRequest, "Invalid privacy setting")
+		return
+	}
+	var audience []int64
+	if payload.Allowed != nil && privacy == "private" {
+		if audience, ok = parseAudience(*payload.Allowed); !ok {
+			utils.Error(w, http.StatusBadRequest, "allowed must be a comma-separated list of user ids")
+			return
+		}
+	}
+	changed := content != oldContent || image != oldImage || privacy != oldPrivacy
+	audienceChanged := privacy != oldPrivacy || (payload.Allowed != nil && privacy == "private")
+	if !changed && !audienceChanged {
+		utils.JSON(w, http.StatusOK, map[string]string{"status": "unchanged"})
+		return
+	}
+
+	now := time.Now()
+	tx, err := db.DB.Begin()
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, "Failed to update post")
+		return
+	}
+	defer tx.Rollback()
+	fail := func(err error) {
+		log.Printf("Failed to update post %d: %v", payload.PostID, err)
+		utils.Error(w, http.StatusInternalServerError, "Failed to update post")
+	}
+	if changed {
+		if _, err := tx.Exec("INSERT INTO post_revisions (post_id, content, image_url, privacy, replaced_at) VALUES (?, ?, ?, ?, ?)",
+			payload.PostID, oldContent, oldImage, oldPrivacy, now); err != nil {
+			fail(err)
+			return
+		}
+		if _, err := tx.Exec("UPDATE posts SET content = ?, image_url = ?, privacy = ?, edited_at = ? WHERE id = ?",
+			content, image, privacy, now, payload.PostID); err != nil {
+			fail(err)
+			return
+		}
+	}
+	if audienceChanged {
+		if _, err := tx.Exec("DELETE FROM post_audience WHERE post_id = ?", payload.PostID); err != nil {
+			fail(err)
+			return
+		}
+		for _, id := range audience {
+			if _, err := tx.Exec("INSERT OR IGNORE INTO post_audience (post_id, user_id) SELECT ?, id FROM users WHERE id = ?", payload.PostID, id); err != nil {
+				fail(err)
+				return
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		fail(err)
+		return
+	}
+	if audienceChanged {
+		QueuePostFanout(payload.PostID)
+	}
+	// also tells people mentioned earlier who can only now see the post
+	mentions := SaveMentions(postMentionTarget(payload.PostID), content, userID)
+	utils.JSON(w, http.StatusOK, map[string]interface{}{"status": "updated", "mentions": mentions})
+}
+
+// POST /api/posts/delete - { post_id }
+// Removes the post with its comments, revisions and unused images.
+func DeletePostHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	uid := utils.GetUserIDFromContext(r)
+	if uid == "" {
+		utils.Error(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	userID, _ := strconv.ParseInt(uid, 10, 64)
+
+	var payload struct {
+		PostID int64 `json:"post_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.PostID <= 0 {
+		utils.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if _, _, _, ok := ownPost(w, payload.PostID, userID); !ok {
+		return
+	}
+	if err := removeContent(moderatedContentTypes["post"], payload.PostID); err != nil {
+		log.Printf("Failed to delete post %d: %v", payload.PostID, err)
+		utils.Error(w, http.StatusInternalServerError, "Failed to delete post")
+		return
+	}
+	utils.JSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+// GET /api/posts/revisions?post_id= - earlier versions of a post, newest first
+// Only the author can read them: a revision may have had a different
+// audience, which post_revisions doesn't record.
+func PostRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	viewerID := requestViewer(w, r)
+	postID, _ := strconv.ParseInt(r.URL.Query().Get("post_id"), 10, 64)
+
+	if ok, err := CanViewPost(viewerID, postID); err != nil || !ok {
+		utils.Error(w, http.StatusNotFound, "Post not found")
+		return
+	}
+	var authorID int64
+	if err := db.DB.QueryRow("SELECT author_id FROM posts WHERE id = ?", postID).Scan(&authorID); err != nil {
+		utils.Error(w, http.StatusNotFound, "Post not found")
+		return
+	}
+	if viewerID != authorID {
+		utils.Error(w, http.StatusForbidden, "Only the author can see earlier versions")
+		return
+	}
+
+	rows, err := db.DB.Query("SELECT id, content, image_url, privacy, replaced_at FROM post_revisions WHERE post_id = ? ORDER BY id DESC", postID)
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, "Failed to load revisions")
+		return
+	}
+	defer rows.Close()
+	revisions := []postRevision{}
+	for rows.Next() {
+		var rev postRevision
+		var image sql.NullString
+		if err := rows.Scan(&rev.ID, &rev.Content, &image, &rev.Privacy, &rev.ReplacedAt); err != nil {
+			continue
+		}
+		rev.ImageURL = normalizeURL(image.String)
+		revisions = append(revisions, rev)
+	}
+	utils.JSON(w, http.StatusOK, map[string]interface{}{"post_id": postID, "revisions": revisions})
+}
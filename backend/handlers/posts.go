@@ -3,8 +3,10 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"social-network/backend/db"
+	"social-network/backend/models"
 	"social-network/backend/utils"
 	"strconv"
 	"strings"
@@ -40,7 +42,7 @@ func CreatePostHandler(w http.ResponseWriter, r *http.Request) {
 		Content  string `json:"content"`
 		ImageURL string `json:"image_url"`
 		Privacy  string `json:"privacy"`
-		Allowed  string `json:"allowed"` // comma-separated ids for private
+		Allowed  string `json:"allowed"` // comma-separated ids of who can see a private post
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
@@ -57,120 +59,236 @@ func CreatePostHandler(w http.ResponseWriter, r *http.Request) {
 		payload.Privacy = "public"
 	}
 
+	if payload.Privacy != "public" && payload.Privacy != "followers" && payload.Privacy != "private" {
+		utils.Error(w, http.StatusBadRequest, "Invalid privacy setting")
+		return
+	}
+	var audience []int64
+	if payload.Privacy == "private" {
+		var ok bool
+		if audience, ok = parseAudience(payload.Allowed); !ok {
+			utils.Error(w, http.StatusBadRequest, "allowed must be a comma-separated list of user ids")
+			return
+		}
+	}
+
 	imagePath := normalizeURL(payload.ImageURL)
 
-	_, err := db.DB.Exec("INSERT INTO posts (author_id, content, image_url, privacy, allowed_user_ids) VALUES (?, ?, ?, ?, ?)", userID, payload.Content, imagePath, payload.Privacy, payload.Allowed)
+	tx, err := db.DB.Begin()
 	if err != nil {
 		utils.Error(w, http.StatusInternalServerError, "Failed to create post")
 		return
 	}
-	utils.JSON(w, http.StatusCreated, map[string]string{"status": "created"})
+	defer tx.Rollback()
+	res, err := tx.Exec("INSERT INTO posts (author_id, content, image_url, privacy) VALUES (?, ?, ?, ?)", userID, payload.Content, imagePath, payload.Privacy)
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, "Failed to create post")
+		return
+	}
+	postID, _ := res.LastInsertId()
+	for _, id := range audience {
+		// ids that aren't users are skipped rather than failing the post
+		if _, err := tx.Exec("INSERT OR IGNORE INTO post_audience (post_id, user_id) SELECT ?, id FROM users WHERE id = ?", postID, id); err != nil {
+			utils.Error(w, http.StatusInternalServerError, "Failed to create post")
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		utils.Error(w, http.StatusInternalServerError, "Failed to create post")
+		return
+	}
+	QueuePostFanout(postID)
+	mentions := SaveMentions(postMentionTarget(postID), payload.Content, userID)
+	utils.JSON(w, http.StatusCreated, map[string]interface{}{"status": "created", "id": postID, "mentions": mentions})
 }
 
-// ListFeedHandler returns posts visible to the requester
-func ListFeedHandler(w http.ResponseWriter, r *http.Request) {
-	// optional ?user_id to list a user's posts
-	viewer := utils.GetUserIDFromContext(r)
-	if viewer == "" {
-		viewer = utils.GetUserIDFromSession(w, r)
+// parseAudience parses a comma-separated list of user ids.
+func parseAudience(csv string) ([]int64, bool) {
+	var ids []int64
+	seen := map[int64]bool{}
+	for _, part := range strings.Split(csv, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(part, 10, 64)
+		if err != nil || id <= 0 {
+			return nil, false
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
 	}
-	var viewerID int64
-	if viewer != "" {
-		viewerID, _ = strconv.ParseInt(viewer, 10, 64)
+	return ids, true
+}
+
+// feedPost is a post as returned by the feed.
+type feedPost struct {
+	ID             int64            `json:"id"`
+	AuthorID       int64            `json:"author_id"`
+	AuthorNickname string           `json:"author_nickname"`
+	Content        string           `json:"content"`
+	ImageURL       string           `json:"image_url"`
+	Privacy        string           `json:"privacy"`
+	Allowed        string           `json:"allowed_user_ids"` // only shown to the author
+	Created        string           `json:"created_at"`
+	Edited         bool             `json:"edited"`
+	EditedAt       string           `json:"edited_at,omitempty"`
+	Mentions       []models.Mention `json:"mentions"`
+	Comments       []commentDTO     `json:"comments"`
+	CommentCount   int              `json:"comment_count"`
+	reactionSummary
+
+	rawCreated string // created_at as stored, for the cursor
+}
+
+// GET /api/posts?user_id=&cursor=&limit=
+// Returns a page of posts, newest first, with next_cursor set when there are
+// more. Signed-in users get their home timeline; without a session it is the
+// public posts. Optional user_id lists one user's posts visible to the requester.
+func ListFeedHandler(w http.ResponseWriter, r *http.Request) {
+	viewerID := requestViewer(w, r)
+
+	cursor, err := parseFeedCursor(r.URL.Query().Get("cursor"))
+	if err != nil {
+		utils.Error(w, http.StatusBadRequest, "Invalid cursor")
+		return
 	}
+	limit := pageLimit(r)
 
+	// the visibility check also covers timeline rows the worker hasn't caught up on
+	visible, args := postVisibilitySQL(viewerID)
+	where := []string{visible}
+	from := "posts p"
+	orderAt, orderID := "p.created_at", "p.id"
 	qUser := r.URL.Query().Get("user_id")
-	var rows *sql.Rows
-	var err error
 	if qUser != "" {
-		// list posts by a specific user, but apply privacy
-		tid, _ := strconv.ParseInt(qUser, 10, 64)
-		rows, err = db.DB.Query(`
-			SELECT p.id, p.author_id, p.content, p.image_url, p.privacy, p.allowed_user_ids, p.created_at, u.nickname 
-			FROM posts p JOIN users u ON p.author_id = u.id 
-			WHERE p.author_id = ? 
-			ORDER BY p.created_at DESC`, tid)
-	} else {
-		// feed: show public posts + posts from followed users + own private posts where allowed
-		rows, err = db.DB.Query(`
-			SELECT p.id, p.author_id, p.content, p.image_url, p.privacy, p.allowed_user_ids, p.created_at, u.nickname 
-			FROM posts p JOIN users u ON p.author_id = u.id 
-			ORDER BY p.created_at DESC`)
+		authorID, _ := strconv.ParseInt(qUser, 10, 64)
+		where = append(where, "p.author_id = ?")
+		args = append(args, authorID)
+	} else if viewerID > 0 {
+		from = "timelines t JOIN posts p ON p.id = t.post_id"
+		orderAt, orderID = "t.created_at", "t.post_id"
+		where = append(where, "t.user_id = ?")
+		args = append(args, viewerID)
 	}
+	if cursor != nil {
+		where = append(where, "("+orderAt+" < ? OR ("+orderAt+" = ? AND "+orderID+" < ?))")
+		args = append(args, cursor.CreatedAt, cursor.CreatedAt, cursor.ID)
+	}
+	// one extra row tells whether there is a next page
+	out, err := queryFeedPosts(viewerID, from, strings.Join(where, " AND "),
+		"ORDER BY "+orderAt+" DESC, "+orderID+" DESC LIMIT ?", append(args, limit+1)...)
 	if err != nil {
 		utils.Error(w, http.StatusInternalServerError, "Failed to load posts")
 		return
 	}
+
+	resp := map[string]interface{}{"next_cursor": nil}
+	if len(out) > limit {
+		out = out[:limit]
+		last := out[limit-1]
+		resp["next_cursor"] = feedCursor{CreatedAt: last.rawCreated, ID: last.ID}.String()
+	}
+	attachPostDetails(out, viewerID)
+	resp["posts"] = out
+	utils.JSON(w, http.StatusOK, resp)
+}
+
+// GET /api/posts/<id> - one post, in the feed's shape, if the requester can see it
+func GetPostHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	viewerID := requestViewer(w, r)
+	postID, err := strconv.ParseInt(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/posts/"), "/"), 10, 64)
+	if err != nil {
+		utils.Error(w, http.StatusNotFound, "Post not found")
+		return
+	}
+
+	visible, args := postVisibilitySQL(viewerID)
+	out, err := queryFeedPosts(viewerID, "posts p", "p.id = ? AND "+visible, "", append([]interface{}{postID}, args...)...)
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, "Failed to load post")
+		return
+	}
+	if len(out) == 0 {
+		utils.Error(w, http.StatusNotFound, "Post not found")
+		return
+	}
+	attachPostDetails(out, viewerID)
+	utils.JSON(w, http.StatusOK, out[0])
+}
+
+// queryFeedPosts selects posts joined from `from` (aliased p) matching where,
+// followed by tail (ORDER BY/LIMIT). The audience of private posts is only
+// filled in for their author.
+func queryFeedPosts(viewerID int64, from, where, tail string, args ...interface{}) ([]feedPost, error) {
+	rows, err := db.DB.Query(`
+		SELECT p.id, p.author_id, p.content, p.image_url, p.privacy, p.created_at, CAST(p.created_at AS TEXT), p.edited_at, u.nickname,
+			CASE WHEN p.author_id = ? THEN (SELECT GROUP_CONCAT(a.user_id) FROM post_audience a WHERE a.post_id = p.id) END
+		FROM `+from+` JOIN users u ON p.author_id = u.id
+		WHERE `+where+`
+		`+tail, append([]interface{}{viewerID}, args...)...)
+	if err != nil {
+		return nil, err
+	}
 	defer rows.Close()
 
-	type P struct {
-		ID             int64        `json:"id"`
-		AuthorID       int64        `json:"author_id"`
-		AuthorNickname string       `json:"author_nickname"`
-		Content        string       `json:"content"`
-		ImageURL       string       `json:"image_url"`
-		Privacy        string       `json:"privacy"`
-		Allowed        string       `json:"allowed_user_ids"`
-		Created        string       `json:"created_at"`
-		Comments       []commentDTO `json:"comments"`
-		CommentCount   int          `json:"comment_count"`
-	}
-	var out []P
+	out := []feedPost{}
 	for rows.Next() {
-		var p P
-		var allowed sql.NullString
-		if err := rows.Scan(&p.ID, &p.AuthorID, &p.Content, &p.ImageURL, &p.Privacy, &allowed, &p.Created, &p.AuthorNickname); err != nil {
+		var p feedPost
+		var image, edited, allowed sql.NullString
+		if err := rows.Scan(&p.ID, &p.AuthorID, &p.Content, &image, &p.Privacy, &p.Created, &p.rawCreated, &edited, &p.AuthorNickname, &allowed); err != nil {
 			continue
 		}
+		p.Edited, p.EditedAt = edited.Valid, edited.String
 		p.Allowed = allowed.String
-		p.ImageURL = normalizeURL(p.ImageURL)
-		// privacy enforcement: minimalistic
-		visible := false
-		if p.Privacy == "public" {
-			visible = true
-		} else if p.Privacy == "followers" {
-			if viewerID > 0 {
-				var cnt int
-				db.DB.QueryRow("SELECT COUNT(1) FROM followers WHERE follower_id=? AND followed_id=?", viewerID, p.AuthorID).Scan(&cnt)
-				if cnt > 0 || viewerID == p.AuthorID {
-					visible = true
-				}
-			}
-		} else if p.Privacy == "private" {
-			if viewerID == p.AuthorID {
-				visible = true
-			} else if p.Allowed != "" {
-				parts := strings.Split(p.Allowed, ",")
-				for _, s := range parts {
-					if s == "" {
-						continue
-					}
-					if vid, _ := strconv.ParseInt(strings.TrimSpace(s), 10, 64); vid == viewerID {
-						visible = true
-						break
-					}
-				}
+		p.ImageURL = normalizeURL(image.String)
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+// attachPostDetails fills in the comments and reactions of posts as seen by viewerID.
+func attachPostDetails(out []feedPost, viewerID int64) {
+	ids := make([]int64, len(out))
+	for i := range out {
+		ids[i] = out[i].ID
+	}
+	postReactions := loadReactions("post", ids, viewerID)
+	postMentions := loadMentions("post", ids)
+	comments, err := loadComments(ids)
+	if err == nil {
+		var commentIDs []int64
+		for _, list := range comments {
+			for _, c := range list {
+				commentIDs = append(commentIDs, c.ID)
 			}
 		}
-		if visible {
-			out = append(out, p)
+		commentReactions := loadReactions("comment", commentIDs, viewerID)
+		commentMentions := loadMentions("comment", commentIDs)
+		for _, list := range comments {
+			for i := range list {
+				list[i].reactionSummary = commentReactions[list[i].ID]
+				list[i].Mentions = commentMentions[list[i].ID]
+			}
 		}
-	}
-
-	if len(out) > 0 {
 		for i := range out {
-			comments, err := loadComments(out[i].ID)
-			if err != nil {
-				continue
-			}
-			out[i].Comments = comments
-			out[i].CommentCount = len(comments)
+			out[i].Comments = comments[out[i].ID]
+			out[i].CommentCount = len(out[i].Comments)
 		}
 	}
-	utils.JSON(w, http.StatusOK, out)
+	for i := range out {
+		out[i].reactionSummary = postReactions[out[i].ID]
+		out[i].Mentions = postMentions[out[i].ID]
+	}
 }
 
-// AddCommentHandler adds a comment to a post (respecting post visibility implicitly by assuming front-end only shows allowed posts)
+// AddCommentHandler adds a comment to a post the user can see
 func AddCommentHandler(w http.ResponseWriter, r *http.Request) {
 	uid := utils.GetUserIDFromContext(r)
 	if uid == "" {
@@ -180,6 +298,7 @@ func AddCommentHandler(w http.ResponseWriter, r *http.Request) {
 	userID, _ := strconv.ParseInt(uid, 10, 64)
 	var payload struct {
 		PostID   int64  `json:"post_id"`
+		ParentID int64  `json:"parent_id,omitempty"` // set to reply to a comment on the same post
 		Content  string `json:"content"`
 		ImageURL string `json:"image_url,omitempty"`
 	}
@@ -187,46 +306,96 @@ func AddCommentHandler(w http.ResponseWriter, r *http.Request) {
 		utils.Error(w, http.StatusBadRequest, "Invalid input")
 		return
 	}
+	canView, err := CanViewPost(userID, payload.PostID)
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, "Failed to add comment")
+		return
+	}
+	if !canView {
+		utils.Error(w, http.StatusNotFound, "Post not found")
+		return
+	}
+	var parentID interface{}
+	var parentAuthor int64
+	if payload.ParentID > 0 {
+		if err := db.DB.QueryRow("SELECT user_id FROM comments WHERE id = ? AND post_id = ? AND removed_at IS NULL", payload.ParentID, payload.PostID).Scan(&parentAuthor); err != nil {
+			utils.Error(w, http.StatusBadRequest, "Invalid parent comment")
+			return
+		}
+		parentID = payload.ParentID
+	}
 	imagePath := normalizeURL(payload.ImageURL)
-	_, err := db.DB.Exec("INSERT INTO comments (post_id, user_id, content, image_url) VALUES (?, ?, ?, ?)", payload.PostID, userID, payload.Content, imagePath)
+	res, err := db.DB.Exec("INSERT INTO comments (post_id, parent_id, user_id, content, image_url) VALUES (?, ?, ?, ?, ?)", payload.PostID, parentID, userID, payload.Content, imagePath)
 	if err != nil {
 		utils.Error(w, http.StatusInternalServerError, "Failed to add comment")
 		return
 	}
-	utils.JSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	commentID, _ := res.LastInsertId()
+	if parentAuthor > 0 && parentAuthor != userID {
+		_ = Notify(parentAuthor, userID, "comment_reply", map[string]interface{}{
+			"post_id":    payload.PostID,
+			"comment_id": commentID,
+			"parent_id":  payload.ParentID,
+			"url":        fmt.Sprintf("/posts/%d", payload.PostID),
+		})
+	}
+	mentions := SaveMentions(commentMentionTarget(commentID, payload.PostID), payload.Content, userID)
+	utils.JSON(w, http.StatusOK, map[string]interface{}{"status": "ok", "id": commentID, "mentions": mentions})
 }
 
 type commentDTO struct {
-	ID        int64  `json:"id"`
-	PostID    int64  `json:"post_id"`
-	UserID    int64  `json:"user_id"`
-	Nickname  string `json:"nickname"`
-	Content   string `json:"content"`
-	ImageURL  string `json:"image_url,omitempty"`
-	CreatedAt string `json:"created_at"`
+	ID         int64            `json:"id"`
+	PostID     int64            `json:"post_id"`
+	ParentID   int64            `json:"parent_id,omitempty"`
+	UserID     int64            `json:"user_id"`
+	Nickname   string           `json:"nickname"`
+	Content    string           `json:"content"`
+	ImageURL   string           `json:"image_url,omitempty"`
+	CreatedAt  string           `json:"created_at"`
+	Edited     bool             `json:"edited"`
+	Removed    bool             `json:"removed,omitempty"` // a tombstone; content is removedCommentText
+	ReplyCount int              `json:"reply_count"`
+	Mentions   []models.Mention `json:"mentions"`
+	reactionSummary
+
+	rawCreated string // created_at as stored, for the cursor
 }
 
-func loadComments(postID int64) ([]commentDTO, error) {
+// loadComments returns the top-level comments of the given posts in one
+// query, keyed by post id. Replies are fetched separately, see CommentRepliesHandler.
+func loadComments(postIDs []int64) (map[int64][]commentDTO, error) {
+	out := map[int64][]commentDTO{}
+	if len(postIDs) == 0 {
+		return out, nil
+	}
+	args := make([]interface{}, len(postIDs))
+	for i, id := range postIDs {
+		args[i] = id
+	}
 	rows, err := db.DB.Query(`
-		SELECT c.id, c.post_id, c.user_id, c.content, c.image_url, c.created_at, IFNULL(u.nickname, '')
+		SELECT c.id, c.post_id, c.user_id, c.content, c.image_url, c.created_at, IFNULL(u.nickname, ''),
+			c.edited_at IS NOT NULL, c.removed_at IS NOT NULL, (SELECT COUNT(1) FROM comments r WHERE r.parent_id = c.id)
 		FROM comments c
 		LEFT JOIN users u ON c.user_id = u.id
-		WHERE c.post_id = ?
-		ORDER BY c.created_at ASC`, postID)
+		WHERE c.parent_id IS NULL AND c.post_id IN (?`+strings.Repeat(", ?", len(postIDs)-1)+`)
+		ORDER BY c.created_at ASC, c.id ASC`, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var comments []commentDTO
 	for rows.Next() {
 		var c commentDTO
 		var image sql.NullString
-		if err := rows.Scan(&c.ID, &c.PostID, &c.UserID, &c.Content, &image, &c.CreatedAt, &c.Nickname); err != nil {
+		if err := rows.Scan(&c.ID, &c.PostID, &c.UserID, &c.Content, &image, &c.CreatedAt, &c.Nickname,
+			&c.Edited, &c.Removed, &c.ReplyCount); err != nil {
 			continue
 		}
 		c.ImageURL = normalizeURL(image.String)
-		comments = append(comments, c)
+		if c.Removed {
+			c.Content = removedCommentText
+		}
+		out[c.PostID] = append(out[c.PostID], c)
 	}
-	return comments, nil
+	return out, nil
 }
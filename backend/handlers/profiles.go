@@ -302,11 +302,18 @@ func TogglePrivacyHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	userID, _ := strconv.ParseInt(uid, 10, 64)
+	var previous string
+	db.DB.QueryRow("SELECT IFNULL(profile_type, 'public') FROM users WHERE id = ?", userID).Scan(&previous)
+
 	_, err := db.DB.Exec(`UPDATE users SET profile_type = ? WHERE id = ?`, payload.ProfileType, uid)
 	if err != nil {
 		utils.Error(w, http.StatusInternalServerError, "Failed to update privacy")
 		return
 	}
+	if previous != payload.ProfileType {
+		Audit(r, "privacy.change", userID, userID, map[string]interface{}{"from": previous, "to": payload.ProfileType})
+	}
 
 	utils.JSON(w, http.StatusOK, map[string]string{"status": "success", "profile_type": payload.ProfileType})
 }
@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"social-network/backend/config"
+	"social-network/backend/db"
+	"social-network/backend/utils"
+)
+
+// Reactions: every user has at most one reaction per post, comment, group
+// post or group comment, either "like" or one of config.ReactionEmojis.
+
+const reactionLike = "like"
+
+// reactionSummary is embedded in items that can be reacted to.
+type reactionSummary struct {
+	Reactions  map[string]int `json:"reactions"`             // count per reaction
+	MyReaction string         `json:"my_reaction,omitempty"` // the viewer's own
+}
+
+// reactionAllowed reports whether r is "like" or a configured emoji.
+func reactionAllowed(r string) bool {
+	if r == reactionLike {
+		return true
+	}
+	for _, e := range config.Current.ReactionEmojis {
+		if e == r {
+			return true
+		}
+	}
+	return false
+}
+
+// reactionTarget looks up the author of an item the viewer may see, plus a
+// link to it for notifications. It fails with sql.ErrNoRows when the item
+// doesn't exist or is hidden from the viewer.
+func reactionTarget(targetType string, id, viewerID int64) (authorID int64, url string, err error) {
+	var parentID int64
+	var ok bool
+	switch targetType {
+	case "post":
+		if ok, err = CanViewPost(viewerID, id); err == nil && !ok {
+			err = sql.ErrNoRows
+		}
+		if err == nil {
+			err = db.DB.QueryRow("SELECT author_id FROM posts WHERE id = ?", id).Scan(&authorID)
+		}
+		url = fmt.Sprintf("/posts/%d", id)
+	case "comment":
+		if parentID, ok, err = CanViewComment(viewerID, id); err == nil && !ok {
+			err = sql.ErrNoRows
+		}
+		if err == nil {
+			err = db.DB.QueryRow("SELECT user_id FROM comments WHERE id = ?", id).Scan(&authorID)
+		}
+		url = fmt.Sprintf("/posts/%d", parentID)
+	case "group_post":
+		err = db.DB.QueryRow(`SELECT gp.author_id, gp.group_id FROM group_posts gp
+			JOIN group_members m ON m.group_id = gp.group_id AND m.user_id = ?
+			WHERE gp.id = ?`, viewerID, id).Scan(&authorID, &parentID)
+		url = fmt.Sprintf("/groups/%d", parentID)
+	case "group_comment":
+		err = db.DB.QueryRow(`SELECT gc.user_id, gp.group_id FROM group_comments gc
+			JOIN group_posts gp ON gp.id = gc.post_id
+			JOIN group_members m ON m.group_id = gp.group_id AND m.user_id = ?
+			WHERE gc.id = ?`, viewerID, id).Scan(&authorID, &parentID)
+		url = fmt.Sprintf("/groups/%d", parentID)
+	default:
+		return 0, "", sql.ErrNoRows
+	}
+	return authorID, url, err
+}
+
+// GET  /api/reactions - the reactions users can choose from
+// POST /api/reactions - { target_type, target_id, reaction }
+// target_type is post, comment, group_post or group_comment. Sending the
+// reaction the user already has (or an empty one) removes it; any other
+// replaces it. Returns the item's new counts and the user's reaction.
+func ReactionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		utils.JSON(w, http.StatusOK, map[string]interface{}{
+			"reactions": append([]string{reactionLike}, config.Current.ReactionEmojis...),
+		})
+		return
+	}
+	if r.Method != http.MethodPost {
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	uid := utils.GetUserIDFromContext(r)
+	if uid == "" {
+		utils.Error(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	userID, _ := strconv.ParseInt(uid, 10, 64)
+
+	var payload struct {
+		TargetType string `json:"target_type"`
+		TargetID   int64  `json:"target_id"`
+		Reaction   string `json:"reaction"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.TargetID <= 0 {
+		utils.Error(w, http.StatusBadRequest, "Invalid input")
+		return
+	}
+	payload.Reaction = strings.TrimSpace(payload.Reaction)
+	if payload.Reaction != "" && !reactionAllowed(payload.Reaction) {
+		utils.Error(w, http.StatusBadRequest, "Unknown reaction")
+		return
+	}
+	authorID, url, err := reactionTarget(payload.TargetType, payload.TargetID, userID)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Reaction target lookup failed (%s %d): %v", payload.TargetType, payload.TargetID, err)
+		}
+		utils.Error(w, http.StatusNotFound, "Not found")
+		return
+	}
+
+	var current sql.NullString
+	db.DB.QueryRow("SELECT reaction FROM reactions WHERE target_type = ? AND target_id = ? AND user_id = ?",
+		payload.TargetType, payload.TargetID, userID).Scan(&current)
+	reaction := payload.Reaction
+	if reaction == current.String {
+		reaction = ""
+	}
+
+	if reaction == "" {
+		_, err = db.DB.Exec("UPDATE reactions SET reaction = NULL WHERE target_type = ? AND target_id = ? AND user_id = ?",
+			payload.TargetType, payload.TargetID, userID)
+	} else {
+		_, err = db.DB.Exec(`INSERT INTO reactions (target_type, target_id, user_id, reaction, created_at) VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT (target_type, target_id, user_id) DO UPDATE SET reaction = excluded.reaction, created_at = excluded.created_at`,
+			payload.TargetType, payload.TargetID, userID, reaction, time.Now())
+	}
+	if err != nil {
+		log.Printf("Failed to save reaction (%s %d): %v", payload.TargetType, payload.TargetID, err)
+		utils.Error(w, http.StatusInternalServerError, "Failed to save reaction")
+		return
+	}
+
+	// the author hears about the first reaction from each user only, however often it is toggled
+	if reaction != "" && authorID != userID {
+		res, err := db.DB.Exec(`UPDATE reactions SET notified_at = ?
+			WHERE target_type = ? AND target_id = ? AND user_id = ? AND notified_at IS NULL`,
+			time.Now(), payload.TargetType, payload.TargetID, userID)
+		if err == nil {
+			if n, _ := res.RowsAffected(); n == 1 {
+				_ = Notify(authorID, userID, "reaction", map[string]interface{}{
+					"target_type": payload.TargetType,
+					"target_id":   payload.TargetID,
+					"reaction":    reaction,
+					"url":         url,
+				})
+			}
+		}
+	}
+
+	summary := loadReactions(payload.TargetType, []int64{payload.TargetID}, userID)[payload.TargetID]
+	utils.JSON(w, http.StatusOK, map[string]interface{}{
+		"target_type": payload.TargetType,
+		"target_id":   payload.TargetID,
+		"reactions":   summary.Reactions,
+		"my_reaction": summary.MyReaction,
+	})
+}
+
+// loadReactions returns the reaction counts of the given items, and which
+// reaction viewerID (0 when signed out) left on each, in one query.
+func loadReactions(targetType string, ids []int64, viewerID int64) map[int64]reactionSummary {
+	out := make(map[int64]reactionSummary, len(ids))
+	for _, id := range ids {
+		out[id] = reactionSummary{Reactions: map[string]int{}}
+	}
+	if len(ids) == 0 {
+		return out
+	}
+	args := []interface{}{viewerID, targetType}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	rows, err := db.DB.Query(`SELECT target_id, reaction, COUNT(1), MAX(user_id = ?) FROM reactions
+		WHERE target_type = ? AND reaction IS NOT NULL AND target_id IN (?`+strings.Repeat(", ?", len(ids)-1)+`)
+		GROUP BY target_id, reaction`, args...)
+	if err != nil {
+		log.Printf("Failed to load %s reactions: %v", targetType, err)
+		return out
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var reaction string
+		var count int
+		var mine bool
+		if err := rows.Scan(&id, &reaction, &count, &mine); err != nil {
+			continue
+		}
+		s := out[id]
+		s.Reactions[reaction] = count
+		if mine {
+			s.MyReaction = reaction
+		}
+		out[id] = s
+	}
+	return out
+}
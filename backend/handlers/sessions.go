@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"social-network/backend/db"
+	"social-network/backend/models"
+	"social-network/backend/utils"
+)
+
+// GET /api/sessions - list the current user's active sessions (one per device)
+func ListSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	uid := utils.GetUserIDFromContext(r)
+	if uid == "" {
+		utils.Error(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	userID, _ := strconv.ParseInt(uid, 10, 64)
+	currentID := utils.GetSessionIDFromContext(r)
+
+	rows, err := db.DB.Query(`
+		SELECT id, user_id, expiry, user_agent, ip_address, created_at, last_seen_at
+		FROM sessions
+		WHERE user_id = ? AND expiry > ?
+		ORDER BY last_seen_at DESC, id DESC`, userID, time.Now())
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, "Failed to query sessions")
+		return
+	}
+	defer rows.Close()
+
+	out := []models.Session{}
+	for rows.Next() {
+		var s models.Session
+		var userAgent, ip sql.NullString
+		var created, lastSeen sql.NullTime
+		if err := rows.Scan(&s.ID, &s.UserID, &s.Expiry, &userAgent, &ip, &created, &lastSeen); err != nil {
+			continue
+		}
+		s.UserAgent = userAgent.String
+		s.IPAddress = ip.String
+		s.CreatedAt = created.Time
+		s.LastSeenAt = lastSeen.Time
+		s.Current = s.ID == currentID
+		out = append(out, s)
+	}
+	utils.JSON(w, http.StatusOK, out)
+}
+
+// POST /api/sessions/revoke - revoke one of the current user's sessions { session_id }
+func RevokeSessionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	uid := utils.GetUserIDFromContext(r)
+	if uid == "" {
+		utils.Error(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	userID, _ := strconv.ParseInt(uid, 10, 64)
+
+	var payload struct {
+		SessionID int64 `json:"session_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.SessionID == 0 {
+		utils.Error(w, http.StatusBadRequest, "Invalid input")
+		return
+	}
+
+	removed, err := utils.RevokeSession(userID, payload.SessionID)
+	if err != nil {
+		log.Printf("Failed to revoke session %d for user %d: %v", payload.SessionID, userID, err)
+		utils.Error(w, http.StatusInternalServerError, "Failed to revoke session")
+		return
+	}
+	if !removed {
+		utils.Error(w, http.StatusNotFound, "Session not found")
+		return
+	}
+
+	Audit(r, "session.revoke", userID, userID, map[string]interface{}{"session_id": payload.SessionID})
+
+	// revoking the session this request came from is effectively a logout
+	if payload.SessionID == utils.GetSessionIDFromContext(r) {
+		utils.ExpireSessionCookie(w)
+	}
+	utils.JSON(w, http.StatusOK, map[string]string{"status": "revoked"})
+}
+
+// POST /api/sessions/revoke-all - revoke every other session of the current user.
+// Pass { include_current: true } to sign out of this device as well.
+func RevokeAllSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	uid := utils.GetUserIDFromContext(r)
+	if uid == "" {
+		utils.Error(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	userID, _ := strconv.ParseInt(uid, 10, 64)
+
+	var payload struct {
+		IncludeCurrent bool `json:"include_current"`
+	}
+	// an empty body keeps the current session
+	if r.ContentLength > 0 {
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			utils.Error(w, http.StatusBadRequest, "Invalid input")
+			return
+		}
+	}
+
+	keep := utils.GetSessionIDFromContext(r)
+	if payload.IncludeCurrent {
+		keep = 0
+	}
+	n, err := utils.RevokeUserSessions(userID, keep)
+	if err != nil {
+		log.Printf("Failed to revoke sessions for user %d: %v", userID, err)
+		utils.Error(w, http.StatusInternalServerError, "Failed to revoke sessions")
+		return
+	}
+	Audit(r, "session.revoke_all", userID, userID, map[string]interface{}{"revoked": n, "include_current": payload.IncludeCurrent})
+	if payload.IncludeCurrent {
+		utils.ExpireSessionCookie(w)
+	}
+	utils.JSON(w, http.StatusOK, map[string]interface{}{"status": "revoked", "revoked": n})
+}
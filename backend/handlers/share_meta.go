@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"social-network/backend/config"
+	"social-network/backend/db"
+)
+
+// Link previews: when the SPA's index.html is served for /posts/<id>,
+// /profile/<id> or /groups/<id> and that content is public, Open Graph and
+// Twitter card tags are added to its <head> so shared links unfurl in other
+// apps. Anything not visible to a signed-out user gets the plain page.
+
+const (
+	shareSiteName       = "Social Network"
+	shareDescriptionLen = 200 // runes
+)
+
+type sharePreview struct {
+	Type        string // og:type
+	Title       string
+	Description string
+	Image       string // path or URL, optional
+}
+
+// loadSharePreview returns the preview for an SPA path, or false when the
+// path isn't a shareable page or its content isn't public.
+func loadSharePreview(path string) (*sharePreview, bool) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) != 2 {
+		return nil, false
+	}
+	id, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || id <= 0 {
+		return nil, false
+	}
+
+	var p sharePreview
+	var first, last, nickname string
+	var text, image sql.NullString
+	switch parts[0] {
+	case "posts":
+		if ok, err := CanViewPost(0, id); err != nil || !ok {
+			return nil, false
+		}
+		err = db.DB.QueryRow(`SELECT p.content, IFNULL(p.image_url, u.avatar), u.first_name, u.last_name, u.nickname
+			FROM posts p JOIN users u ON u.id = p.author_id WHERE p.id = ?`, id).
+			Scan(&text, &image, &first, &last, &nickname)
+		p.Type = "article"
+		p.Title = fmt.Sprintf("Post by %s %s (@%s)", first, last, nickname)
+	case "profile":
+		err = db.DB.QueryRow(`SELECT about_me, avatar, first_name, last_name, nickname FROM users
+			WHERE id = ? AND IFNULL(profile_type, 'public') = 'public'`, id).
+			Scan(&text, &image, &first, &last, &nickname)
+		p.Type = "profile"
+		p.Title = fmt.Sprintf("%s %s (@%s)", first, last, nickname)
+	case "groups":
+		err = db.DB.QueryRow("SELECT name, description FROM groups WHERE id = ?", id).Scan(&p.Title, &text)
+		p.Type = "website"
+	default:
+		return nil, false
+	}
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Failed to load share preview for %s: %v", path, err)
+		}
+		return nil, false
+	}
+	p.Description = truncateRunes(strings.Join(strings.Fields(text.String), " "), shareDescriptionLen)
+	p.Image = normalizeURL(image.String)
+	return &p, true
+}
+
+func truncateRunes(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return strings.TrimSpace(string(r[:n-1])) + "…"
+}
+
+// absoluteURL makes a site path absolute against APP_BASE_URL; crawlers
+// need full URLs.
+func absoluteURL(path string) string {
+	if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+		return path
+	}
+	return config.Current.AppBaseURL + path
+}
+
+// metaTags renders the preview as <meta> tags for page path.
+func (p *sharePreview) metaTags(path string) []byte {
+	var b bytes.Buffer
+	tag := func(attr, key, value string) {
+		if value != "" {
+			fmt.Fprintf(&b, "    <meta %s=\"%s\" content=\"%s\">\n", attr, key, html.EscapeString(value))
+		}
+	}
+	card := "summary"
+	if p.Image != "" {
+		card = "summary_large_image"
+	}
+	tag("property", "og:site_name", shareSiteName)
+	tag("property", "og:type", p.Type)
+	tag("property", "og:title", p.Title)
+	tag("property", "og:description", p.Description)
+	tag("property", "og:url", absoluteURL(path))
+	if p.Image != "" {
+		tag("property", "og:image", absoluteURL(p.Image))
+	}
+	tag("name", "twitter:card", card)
+	tag("name", "twitter:title", p.Title)
+	tag("name", "twitter:description", p.Description)
+	if p.Image != "" {
+		tag("name", "twitter:image", absoluteURL(p.Image))
+	}
+	return b.Bytes()
+}
+
+// ServeIndex serves the SPA's index.html for r, with link preview tags
+// when r is for a public post, profile or group.
+func ServeIndex(w http.ResponseWriter, r *http.Request, indexPath string) {
+	preview, ok := loadSharePreview(r.URL.Path)
+	if !ok {
+		http.ServeFile(w, r, indexPath)
+		return
+	}
+	page, err := os.ReadFile(indexPath)
+	head := bytes.Index(page, []byte("</head>"))
+	if err != nil || head < 0 {
+		http.ServeFile(w, r, indexPath)
+		return
+	}
+	// insert the tags on their own lines, ahead of the indentation before </head>
+	if line := bytes.LastIndexByte(page[:head], '\n') + 1; len(bytes.TrimSpace(page[line:head])) == 0 {
+		head = line
+	}
+	path := strings.TrimRight(r.URL.Path, "/")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	// the tags follow the content, so don't let caches keep a stale copy
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(page[:head])
+	w.Write(preview.metaTags(path))
+	w.Write(page[head:])
+}
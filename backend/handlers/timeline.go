@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"log"
+	"time"
+
+	"social-network/backend/db"
+)
+
+// Home timelines are materialized in the timelines table: when a post is
+// created a background worker writes a row for every user whose feed it
+// belongs in (the author, followers for public and followers-only posts, the
+// selected audience for private ones). Follows backfill recent posts and
+// unfollows remove them. Jobs live in memory; a post whose fan-out was lost
+// in a restart still has fanned_out_at NULL and is fanned out at startup.
+
+const (
+	timelineQueueSize = 1024
+	// followBackfillLimit is how many of a newly followed user's posts are
+	// copied into the follower's timeline.
+	followBackfillLimit = 100
+)
+
+type timelineJob struct {
+	postID             int64 // fan out (or re-fan out) a post
+	follower, followed int64 // follow or unfollow
+	unfollow           bool
+}
+
+var timelineJobs = make(chan timelineJob, timelineQueueSize)
+
+// StartTimelineWorker starts the fan-out worker and queues posts that were
+// never fanned out. It is called once from main.
+func StartTimelineWorker() {
+	go func() {
+		for job := range timelineJobs {
+			runTimelineJob(job)
+		}
+	}()
+
+	rows, err := db.DB.Query("SELECT id FROM posts WHERE fanned_out_at IS NULL ORDER BY id")
+	if err != nil {
+		log.Println("Timeline requeue error:", err)
+		return
+	}
+	var pending []int64
+	for rows.Next() {
+		var id int64
+		if rows.Scan(&id) == nil {
+			pending = append(pending, id)
+		}
+	}
+	rows.Close()
+	// queued from the background, so a long backlog doesn't hold up startup
+	go func() {
+		for _, id := range pending {
+			QueuePostFanout(id)
+		}
+	}()
+}
+
+// queueTimelineJob hands job to the worker, waiting for room in the queue
+// when it is behind. Jobs only ever run on the worker, one at a time and in
+// order, so a follow and a later unfollow can't race each other.
+func queueTimelineJob(job timelineJob) {
+	timelineJobs <- job
+}
+
+// QueuePostFanout brings the timelines in line with a post's current
+// audience: it is added where it now belongs and removed where it no longer
+// does. Use it for new posts and when a post's privacy or audience changes.
+func QueuePostFanout(postID int64) {
+	queueTimelineJob(timelineJob{postID: postID})
+}
+
+// QueueFollow backfills the follower's timeline with the followed user's recent posts.
+func QueueFollow(follower, followed int64) {
+	queueTimelineJob(timelineJob{follower: follower, followed: followed})
+}
+
+// QueueUnfollow removes the followed user's posts from the follower's
+// timeline, except private posts the follower was picked to see.
+func QueueUnfollow(follower, followed int64) {
+	queueTimelineJob(timelineJob{follower: follower, followed: followed, unfollow: true})
+}
+
+func runTimelineJob(job timelineJob) {
+	var err error
+	switch {
+	case job.postID > 0:
+		err = fanOutPost(job.postID)
+	case job.unfollow:
+		_, err = db.DB.Exec(`DELETE FROM timelines WHERE user_id = ?1 AND author_id = ?2
+			AND post_id NOT IN (SELECT post_id FROM post_audience WHERE user_id = ?1)`, job.follower, job.followed)
+	default:
+		_, err = db.DB.Exec(`INSERT OR IGNORE INTO timelines (user_id, post_id, author_id, created_at)
+			SELECT ?1, p.id, p.author_id, p.created_at FROM posts p
+			WHERE p.author_id = ?2 AND p.privacy IN ('public', 'followers')
+				AND EXISTS (SELECT 1 FROM followers WHERE follower_id = ?1 AND followed_id = ?2)
+			ORDER BY p.created_at DESC, p.id DESC LIMIT ?3`, job.follower, job.followed, followBackfillLimit)
+	}
+	if err != nil {
+		log.Printf("Timeline job %+v failed: %v", job, err)
+	}
+}
+
+// postAudienceSQL selects (as user_id) everyone whose timeline post ?1 belongs in.
+const postAudienceSQL = `
+	SELECT author_id AS user_id FROM posts WHERE id = ?1
+	UNION
+	SELECT f.follower_id FROM posts p JOIN followers f ON f.followed_id = p.author_id
+	WHERE p.id = ?1 AND p.privacy IN ('public', 'followers')
+	UNION
+	SELECT a.user_id FROM posts p JOIN post_audience a ON a.post_id = p.id
+	WHERE p.id = ?1 AND p.privacy = 'private'`
+
+func fanOutPost(postID int64) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("DELETE FROM timelines WHERE post_id = ?1 AND user_id NOT IN ("+postAudienceSQL+")", postID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`INSERT OR IGNORE INTO timelines (user_id, post_id, author_id, created_at)
+		SELECT e.user_id, p.id, p.author_id, p.created_at FROM posts p, (`+postAudienceSQL+`) e
+		WHERE p.id = ?1`, postID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE posts SET fanned_out_at = ? WHERE id = ?", time.Now(), postID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
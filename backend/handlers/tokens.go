@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"social-network/backend/config"
+	"social-network/backend/db"
+	"social-network/backend/models"
+	"social-network/backend/utils"
+)
+
+// POST /api/token - { identifier, password } or { challenge, code | recovery_code }
+// Token login for non-browser clients. Accounts with 2FA first get an MFA
+// challenge (as with /login), which is then exchanged here for tokens.
+func TokenHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	var payload struct {
+		Identifier   string `json:"identifier"`
+		Password     string `json:"password"`
+		Challenge    string `json:"challenge"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		utils.Error(w, http.StatusBadRequest, "Invalid input")
+		return
+	}
+
+	var userID int64
+	var ok bool
+	switch {
+	case payload.Challenge != "":
+		if userID, ok = completeMFAChallenge(w, r, payload.Challenge, payload.Code, payload.RecoveryCode); !ok {
+			return
+		}
+	case payload.Identifier != "" && payload.Password != "":
+		if userID, ok = checkLoginCredentials(w, r, payload.Identifier, payload.Password); !ok {
+			return
+		}
+		if requireSecondFactor(w, userID) {
+			return
+		}
+	default:
+		utils.Error(w, http.StatusBadRequest, "Invalid input")
+		return
+	}
+
+	sessionID, err := utils.CreateTokenSession(r, userID, time.Now().Add(config.Current.RefreshTokenTTL))
+	if err != nil {
+		log.Printf("Token session creation error: %v", err)
+		utils.Error(w, http.StatusInternalServerError, "Server error")
+		return
+	}
+	resp, err := issueTokens(userID, sessionID)
+	if err != nil {
+		log.Printf("Token issue error for user %d: %v", userID, err)
+		utils.Error(w, http.StatusInternalServerError, "Server error")
+		return
+	}
+	resp.DeletionCancelled = cancelAccountDeletion(userID)
+	Audit(r, "login.success", userID, userID, map[string]interface{}{
+		"method": "token", "session_id": sessionID, "deletion_cancelled": resp.DeletionCancelled,
+	})
+	utils.JSON(w, http.StatusOK, resp)
+}
+
+// POST /api/token/refresh - { refresh_token }
+// Exchanges a refresh token for a new access token and a new refresh token.
+// Each refresh token works once; replaying a used one revokes the session,
+// since it means the token has leaked.
+func RefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	var payload struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.RefreshToken == "" {
+		utils.Error(w, http.StatusBadRequest, "Invalid input")
+		return
+	}
+
+	now := time.Now()
+	var tokenID, sessionID, userID int64
+	var expiresAt time.Time
+	var usedAt sql.NullTime
+	err := db.DB.QueryRow("SELECT id, session_id, user_id, expires_at, used_at FROM refresh_tokens WHERE token_hash = ?",
+		utils.HashToken(payload.RefreshToken)).Scan(&tokenID, &sessionID, &userID, &expiresAt, &usedAt)
+	if err != nil || now.After(expiresAt) {
+		utils.Error(w, http.StatusUnauthorized, "Invalid refresh token")
+		return
+	}
+	if usedAt.Valid {
+		log.Printf("Refresh token reuse for user %d, revoking session %d", userID, sessionID)
+		revokeTokenSession(userID, sessionID)
+		Audit(r, "token.reuse_detected", userID, 0, map[string]interface{}{"session_id": sessionID})
+		utils.Error(w, http.StatusUnauthorized, "Invalid refresh token")
+		return
+	}
+	var sessionExpiry time.Time
+	if err := db.DB.QueryRow("SELECT expiry FROM sessions WHERE id = ? AND user_id = ?", sessionID, userID).Scan(&sessionExpiry); err != nil || now.After(sessionExpiry) {
+		// the session was signed out or has expired
+		utils.Error(w, http.StatusUnauthorized, "Invalid refresh token")
+		return
+	}
+
+	// claim the token; a concurrent refresh with the same token loses here
+	res, err := db.DB.Exec("UPDATE refresh_tokens SET used_at = ? WHERE id = ? AND used_at IS NULL", now, tokenID)
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, "Server error")
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		utils.Error(w, http.StatusUnauthorized, "Invalid refresh token")
+		return
+	}
+	db.DB.Exec("UPDATE sessions SET expiry = ?, last_seen_at = ? WHERE id = ?", now.Add(config.Current.RefreshTokenTTL), now, sessionID)
+
+	resp, err := issueTokens(userID, sessionID)
+	if err != nil {
+		log.Printf("Token issue error for user %d: %v", userID, err)
+		utils.Error(w, http.StatusInternalServerError, "Server error")
+		return
+	}
+	utils.JSON(w, http.StatusOK, resp)
+}
+
+// POST /api/token/revoke - { refresh_token }
+// Signs out the token's session, and with it the access tokens issued for it.
+func RevokeTokenHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	var payload struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.RefreshToken == "" {
+		utils.Error(w, http.StatusBadRequest, "Invalid input")
+		return
+	}
+	var sessionID, userID int64
+	err := db.DB.QueryRow("SELECT session_id, user_id FROM refresh_tokens WHERE token_hash = ?",
+		utils.HashToken(payload.RefreshToken)).Scan(&sessionID, &userID)
+	if err == nil {
+		revokeTokenSession(userID, sessionID)
+		Audit(r, "session.revoke", userID, userID, map[string]interface{}{"session_id": sessionID, "via": "refresh_token"})
+	}
+	// same answer either way, like RFC 7009
+	utils.JSON(w, http.StatusOK, map[string]string{"status": "revoked"})
+}
+
+// GET /.well-known/jwks.json - public keys for verifying EdDSA access tokens
+func JWKSHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	utils.JSON(w, http.StatusOK, utils.JWKS())
+}
+
+// issueTokens signs an access token for the session and stores a fresh refresh token.
+func issueTokens(userID, sessionID int64) (models.TokenResponse, error) {
+	access, _, err := utils.SignAccessToken(userID, sessionID, config.Current.AccessTokenTTL)
+	if err != nil {
+		return models.TokenResponse{}, err
+	}
+	refresh, err := utils.NewToken()
+	if err != nil {
+		return models.TokenResponse{}, err
+	}
+	_, err = db.DB.Exec("INSERT INTO refresh_tokens (session_id, user_id, token_hash, expires_at, created_at) VALUES (?, ?, ?, ?, ?)",
+		sessionID, userID, utils.HashToken(refresh), time.Now().Add(config.Current.RefreshTokenTTL), time.Now())
+	if err != nil {
+		return models.TokenResponse{}, err
+	}
+	return models.TokenResponse{
+		AccessToken:  access,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(config.Current.AccessTokenTTL.Seconds()),
+		RefreshToken: refresh,
+		UserID:       strconv.FormatInt(userID, 10),
+	}, nil
+}
+
+func revokeTokenSession(userID, sessionID int64) {
+	if _, err := utils.RevokeSession(userID, sessionID); err != nil {
+		log.Printf("Failed to revoke session %d: %v", sessionID, err)
+	}
+	db.DB.Exec("DELETE FROM refresh_tokens WHERE session_id = ?", sessionID)
+}
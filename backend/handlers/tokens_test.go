@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"social-network/backend/db"
+	"social-network/backend/models"
+	"social-network/backend/utils"
+)
+
+func refresh(t *testing.T, token string) (int, models.TokenResponse) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	RefreshTokenHandler(rec, httptest.NewRequest(http.MethodPost, "/api/token/refresh",
+		strings.NewReader(`{"refresh_token": "`+token+`"}`)))
+	var resp models.TokenResponse
+	json.NewDecoder(rec.Body).Decode(&resp)
+	return rec.Code, resp
+}
+
+func TestRefreshTokenReuseRevokesSession(t *testing.T) {
+	setupTestDB(t)
+	const userID int64 = 1
+	if _, err := db.DB.Exec("INSERT INTO users (id, email, password, first_name, last_name, nickname) VALUES (1, 'token@example.com', 'x', 'T', 'T', 'token')"); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := utils.GenerateJWTKeySet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.SetJWTKeys(keys)
+	t.Cleanup(func() { utils.SetJWTKeys(nil) })
+
+	sessionID, err := utils.CreateTokenSession(httptest.NewRequest(http.MethodPost, "/api/token", nil), userID, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := issueTokens(userID, sessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c, err := utils.ParseAccessToken(first.AccessToken); err != nil || c.UserID() != userID || c.SessionID != sessionID {
+		t.Fatalf("access token = %+v, %v", c, err)
+	}
+
+	code, second := refresh(t, first.RefreshToken)
+	if code != http.StatusOK || second.RefreshToken == "" || second.RefreshToken == first.RefreshToken {
+		t.Fatalf("first refresh: status %d, %+v", code, second)
+	}
+
+	steps := []struct {
+		name  string
+		token string
+	}{
+		// someone replays the used token: the whole session goes
+		{"replayed token", first.RefreshToken},
+		// including the token the legitimate client got in exchange
+		{"token issued after it", second.RefreshToken},
+		{"unknown token", "not-a-refresh-token"},
+	}
+	for _, step := range steps {
+		if code, _ := refresh(t, step.token); code != http.StatusUnauthorized {
+			t.Errorf("%s: status %d, want 401", step.name, code)
+		}
+	}
+
+	var sessions, tokens, audits int
+	db.DB.QueryRow("SELECT COUNT(1) FROM sessions WHERE id = ?", sessionID).Scan(&sessions)
+	db.DB.QueryRow("SELECT COUNT(1) FROM refresh_tokens WHERE session_id = ?", sessionID).Scan(&tokens)
+	db.DB.QueryRow("SELECT COUNT(1) FROM audit_log WHERE action = 'token.reuse_detected' AND user_id = ?", userID).Scan(&audits)
+	if sessions != 0 || tokens != 0 || audits != 1 {
+		t.Errorf("after reuse: %d sessions, %d refresh tokens, %d audit entries; want 0, 0, 1", sessions, tokens, audits)
+	}
+}
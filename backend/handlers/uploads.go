@@ -3,9 +3,11 @@ package handlers
 import (
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"social-network/backend/db"
 	"social-network/backend/utils"
 	"strings"
 	"time"
@@ -82,3 +84,51 @@ func UploadHandler(w http.ResponseWriter, r *http.Request) {
 		"url": relPath,
 	})
 }
+
+// uploadFilePath maps a stored upload URL ("/uploads/posts/x.jpg", possibly
+// made absolute by utils.AbsURL) to its file on disk. It refuses anything that
+// would resolve outside backend/uploads.
+func uploadFilePath(u string) (string, bool) {
+	idx := strings.Index(u, "/uploads/")
+	if idx < 0 {
+		return "", false
+	}
+	rel := filepath.Clean(filepath.FromSlash(u[idx+len("/uploads/"):]))
+	if rel == "." || filepath.IsAbs(rel) || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.Join("backend", "uploads", rel), true
+}
+
+// removeUnreferencedUploads deletes the files behind the given upload URLs,
+// skipping any that are still used by a remaining avatar, post, post revision
+// or comment (group post images are named after the original file, so they can be shared).
+func removeUnreferencedUploads(urls []string) {
+	seen := map[string]bool{}
+	for _, u := range urls {
+		u = normalizeURL(u)
+		if u == "" || seen[u] {
+			continue
+		}
+		seen[u] = true
+		var refs int
+		db.DB.QueryRow(`SELECT
+			(SELECT COUNT(1) FROM users WHERE avatar = ?) +
+			(SELECT COUNT(1) FROM posts WHERE image_url = ?) +
+			(SELECT COUNT(1) FROM post_revisions WHERE image_url = ?) +
+			(SELECT COUNT(1) FROM comments WHERE image_url = ?) +
+			(SELECT COUNT(1) FROM group_posts WHERE image_url = ?) +
+			(SELECT COUNT(1) FROM group_comments WHERE image_url = ?) +
+			(SELECT COUNT(1) FROM comment_archive WHERE image_url = ?)`, u, u, u, u, u, u, u).Scan(&refs)
+		if refs > 0 {
+			continue
+		}
+		path, ok := uploadFilePath(u)
+		if !ok {
+			continue
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to remove upload %s: %v", path, err)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"social-network/backend/config"
+	"social-network/backend/db"
+	"social-network/backend/mailer"
+	"social-network/backend/utils"
+)
+
+// resendCooldown is the minimum time between two verification emails for the same user.
+const resendCooldown = time.Minute
+
+// SendVerificationEmail issues a fresh verification token for email and mails
+// the link to it. Earlier pending tokens of the user are invalidated.
+func SendVerificationEmail(userID int64, email string) error {
+	token, err := utils.NewToken()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	db.DB.Exec("UPDATE email_verifications SET used_at = ? WHERE user_id = ? AND used_at IS NULL", now, userID)
+	_, err = db.DB.Exec("INSERT INTO email_verifications (user_id, email, token_hash, expires_at) VALUES (?, ?, ?, ?)",
+		userID, email, utils.HashToken(token), now.Add(config.Current.EmailVerificationTTL))
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/verify-email?token=%s", config.Current.AppBaseURL, url.QueryEscape(token))
+	return mailer.Send(mailer.Message{
+		To:      email,
+		Subject: "Confirm your email address",
+		Body: fmt.Sprintf("Please confirm this email address by opening the link below (valid for %s):\n%s\n\n"+
+			"If you didn't request this, you can ignore this email.", config.Current.EmailVerificationTTL, link),
+	})
+}
+
+// IsEmailVerified reports whether the user has confirmed their email address.
+func IsEmailVerified(userID int64) bool {
+	var verifiedAt sql.NullTime
+	if err := db.DB.QueryRow("SELECT verified_at FROM users WHERE id = ?", userID).Scan(&verifiedAt); err != nil {
+		return false
+	}
+	return verifiedAt.Valid
+}
+
+// VerificationRequired reports whether action ("post", "comment", "message",
+// "group") is blocked for the user because their email is still unverified.
+func VerificationRequired(userID int64, action string) bool {
+	restricted := false
+	for _, a := range config.Current.UnverifiedRestrictions {
+		if a == action {
+			restricted = true
+			break
+		}
+	}
+	return restricted && !IsEmailVerified(userID)
+}
+
+// POST /api/email/verify - { token }
+func VerifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	var payload struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.Token == "" {
+		utils.Error(w, http.StatusBadRequest, "Invalid input")
+		return
+	}
+
+	var verificationID, userID int64
+	var email string
+	var expiresAt time.Time
+	err := db.DB.QueryRow("SELECT id, user_id, email, expires_at FROM email_verifications WHERE token_hash = ? AND used_at IS NULL",
+		utils.HashToken(payload.Token)).Scan(&verificationID, &userID, &email, &expiresAt)
+	if err != nil || time.Now().After(expiresAt) {
+		utils.Error(w, http.StatusBadRequest, "Invalid or expired verification link")
+		return
+	}
+
+	// the address may have been taken by someone else while the link was pending
+	var taken int
+	db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE email = ? AND id != ?)", email, userID).Scan(&taken)
+	if taken != 0 {
+		utils.Error(w, http.StatusConflict, "Email already in use")
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, "Server error")
+		return
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	res, err := tx.Exec("UPDATE email_verifications SET used_at = ? WHERE id = ? AND used_at IS NULL", now, verificationID)
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, "Server error")
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		utils.Error(w, http.StatusBadRequest, "Invalid or expired verification link")
+		return
+	}
+	if _, err := tx.Exec("UPDATE users SET email = ?, verified_at = ? WHERE id = ?", email, now, userID); err != nil {
+		log.Printf("Email verification update error for user %d: %v", userID, err)
+		utils.Error(w, http.StatusInternalServerError, "Failed to verify email")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		utils.Error(w, http.StatusInternalServerError, "Failed to verify email")
+		return
+	}
+	// a verified address listed in ADMIN_EMAILS makes the account an admin
+	BootstrapAdmins()
+	utils.JSON(w, http.StatusOK, map[string]string{"status": "verified", "email": email})
+}
+
+// POST /api/email/verify/resend - send a new verification link to the current user
+func ResendVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	uid := utils.GetUserIDFromContext(r)
+	if uid == "" {
+		utils.Error(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	userID, _ := strconv.ParseInt(uid, 10, 64)
+
+	var email string
+	var verifiedAt sql.NullTime
+	if err := db.DB.QueryRow("SELECT email, verified_at FROM users WHERE id = ?", userID).Scan(&email, &verifiedAt); err != nil {
+		utils.Error(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	// a pending email change is re-sent to the new address rather than the current one
+	target := email
+	var pendingEmail string
+	var lastSent time.Time
+	var unused int
+	err := db.DB.QueryRow("SELECT email, created_at, used_at IS NULL FROM email_verifications WHERE user_id = ? ORDER BY id DESC LIMIT 1", userID).
+		Scan(&pendingEmail, &lastSent, &unused)
+	if err == nil && unused == 1 && !strings.EqualFold(pendingEmail, email) {
+		target = pendingEmail
+	}
+	if target == email && verifiedAt.Valid {
+		utils.JSON(w, http.StatusOK, map[string]string{"status": "already_verified"})
+		return
+	}
+	if err == nil && time.Since(lastSent) < resendCooldown {
+		w.Header().Set("Retry-After", strconv.Itoa(int((resendCooldown-time.Since(lastSent)).Seconds())+1))
+		utils.Error(w, http.StatusTooManyRequests, "Please wait before requesting another email")
+		return
+	}
+
+	if err := SendVerificationEmail(userID, target); err != nil {
+		log.Printf("Failed to resend verification email for user %d: %v", userID, err)
+		utils.Error(w, http.StatusInternalServerError, "Failed to send verification email")
+		return
+	}
+	utils.JSON(w, http.StatusOK, map[string]string{"status": "sent"})
+}
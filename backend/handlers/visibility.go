@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"social-network/backend/db"
+	"social-network/backend/utils"
+)
+
+// Post visibility. Every handler that shows a post, or anything attached to
+// one, checks access through CanViewPost (single posts) or postVisibilitySQL
+// (lists), so the rules live here only.
+
+// postVisibilitySQL is the condition under which viewerID (0 when signed
+// out) may see post p: public posts, the author's own, "followers" posts of
+// people they follow and "private" posts they are in the audience of.
+func postVisibilitySQL(viewerID int64) (string, []interface{}) {
+	return `(p.privacy = 'public'
+		OR p.author_id = ?
+		OR (p.privacy = 'followers' AND EXISTS (SELECT 1 FROM followers f WHERE f.follower_id = ? AND f.followed_id = p.author_id))
+		OR (p.privacy = 'private' AND EXISTS (SELECT 1 FROM post_audience a WHERE a.post_id = p.id AND a.user_id = ?)))`,
+		[]interface{}{viewerID, viewerID, viewerID}
+}
+
+// CanViewPost reports whether viewerID (0 when signed out) may see the post.
+// A post that doesn't exist can't be seen.
+func CanViewPost(viewerID, postID int64) (bool, error) {
+	visible, args := postVisibilitySQL(viewerID)
+	var n int
+	err := db.DB.QueryRow("SELECT COUNT(1) FROM posts p WHERE p.id = ? AND "+visible,
+		append([]interface{}{postID}, args...)...).Scan(&n)
+	return n > 0, err
+}
+
+// CanViewComment reports whether viewerID may see the comment, which is
+// whenever they may see its post, and returns the post's id.
+func CanViewComment(viewerID, commentID int64) (int64, bool, error) {
+	var postID int64
+	err := db.DB.QueryRow("SELECT post_id FROM comments WHERE id = ?", commentID).Scan(&postID)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	ok, err := CanViewPost(viewerID, postID)
+	return postID, ok, err
+}
+
+// requestViewer returns the id of the signed-in requester on routes that
+// also serve anonymous users, or 0.
+func requestViewer(w http.ResponseWriter, r *http.Request) int64 {
+	viewer := utils.GetUserIDFromContext(r)
+	if viewer == "" {
+		viewer = utils.GetUserIDFromSession(w, r)
+	}
+	id, _ := strconv.ParseInt(viewer, 10, 64)
+	return id
+}
@@ -0,0 +1,264 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"social-network/backend/db"
+	"social-network/backend/utils"
+)
+
+// Users and posts seeded by setupVisibilityDB.
+const (
+	anonymous int64 = 0
+	author    int64 = 1
+	follower  int64 = 2 // follows author
+	picked    int64 = 3 // in the audience of the private post, doesn't follow
+	stranger  int64 = 4
+
+	publicPost    int64 = 1
+	followersPost int64 = 2
+	privatePost   int64 = 3
+)
+
+func setupVisibilityDB(t *testing.T) {
+	t.Helper()
+	setupTestDB(t)
+	stmts := []string{
+		`INSERT INTO users (id, email, password, first_name, last_name, nickname) VALUES
+			(1, 'author@example.com', 'x', 'A', 'A', 'author'),
+			(2, 'follower@example.com', 'x', 'F', 'F', 'follower'),
+			(3, 'picked@example.com', 'x', 'P', 'P', 'picked'),
+			(4, 'stranger@example.com', 'x', 'S', 'S', 'stranger')`,
+		"INSERT INTO followers (follower_id, followed_id) VALUES (2, 1)",
+		`INSERT INTO posts (id, author_id, content, privacy) VALUES
+			(1, 1, 'public', 'public'),
+			(2, 1, 'followers only', 'followers'),
+			(3, 1, 'private', 'private')`,
+		"INSERT INTO post_audience (post_id, user_id) VALUES (3, 3)",
+	}
+	for _, q := range stmts {
+		if _, err := db.DB.Exec(q); err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+	}
+}
+
+// visibilityCases is who may see which seeded post.
+var visibilityCases = []struct {
+	name   string
+	postID int64
+	viewer int64
+	want   bool
+}{
+	{"public/author", publicPost, author, true},
+	{"public/follower", publicPost, follower, true},
+	{"public/picked", publicPost, picked, true},
+	{"public/stranger", publicPost, stranger, true},
+	{"public/anonymous", publicPost, anonymous, true},
+
+	{"followers/author", followersPost, author, true},
+	{"followers/follower", followersPost, follower, true},
+	{"followers/picked", followersPost, picked, false},
+	{"followers/stranger", followersPost, stranger, false},
+	{"followers/anonymous", followersPost, anonymous, false},
+
+	{"private/author", privatePost, author, true},
+	{"private/picked", privatePost, picked, true},
+	{"private/follower", privatePost, follower, false},
+	{"private/stranger", privatePost, stranger, false},
+	{"private/anonymous", privatePost, anonymous, false},
+}
+
+func asUser(r *http.Request, userID int64) *http.Request {
+	if userID == anonymous {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), utils.UserIDKey, strconv.FormatInt(userID, 10)))
+}
+
+func TestCanViewPost(t *testing.T) {
+	setupVisibilityDB(t)
+	for _, tc := range visibilityCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := CanViewPost(tc.viewer, tc.postID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("CanViewPost(%d, %d) = %v, want %v", tc.viewer, tc.postID, got, tc.want)
+			}
+		})
+	}
+	if ok, err := CanViewPost(author, 99); err != nil || ok {
+		t.Errorf("CanViewPost on a missing post = %v, %v; want false, nil", ok, err)
+	}
+}
+
+func TestAddCommentRequiresVisiblePost(t *testing.T) {
+	setupVisibilityDB(t)
+	for _, tc := range visibilityCases {
+		if tc.viewer == anonymous {
+			continue // the route requires a signed-in user
+		}
+		t.Run(tc.name, func(t *testing.T) {
+			body := `{"post_id": ` + strconv.FormatInt(tc.postID, 10) + `, "content": "hi"}`
+			req := asUser(httptest.NewRequest(http.MethodPost, "/api/posts/comment", strings.NewReader(body)), tc.viewer)
+			rec := httptest.NewRecorder()
+			AddCommentHandler(rec, req)
+
+			var stored int
+			db.DB.QueryRow("SELECT COUNT(1) FROM comments WHERE post_id = ? AND user_id = ?", tc.postID, tc.viewer).Scan(&stored)
+			if tc.want {
+				if rec.Code != http.StatusOK || stored != 1 {
+					t.Errorf("status %d, %d comments stored; want 200 and 1", rec.Code, stored)
+				}
+			} else if rec.Code != http.StatusNotFound || stored != 0 {
+				t.Errorf("status %d, %d comments stored; want 404 and none", rec.Code, stored)
+			}
+		})
+	}
+}
+
+func TestCommentRepliesRequireVisiblePost(t *testing.T) {
+	setupVisibilityDB(t)
+	// a comment on every post, each with one reply
+	for _, postID := range []int64{publicPost, followersPost, privatePost} {
+		res, err := db.DB.Exec("INSERT INTO comments (post_id, user_id, content) VALUES (?, ?, 'top')", postID, author)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parent, _ := res.LastInsertId()
+		if _, err := db.DB.Exec("INSERT INTO comments (post_id, parent_id, user_id, content) VALUES (?, ?, ?, 'reply')", postID, parent, author); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, tc := range visibilityCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var commentID int64
+			db.DB.QueryRow("SELECT id FROM comments WHERE post_id = ? AND parent_id IS NULL", tc.postID).Scan(&commentID)
+			url := "/api/posts/comment/replies?comment_id=" + strconv.FormatInt(commentID, 10)
+			rec := httptest.NewRecorder()
+			CommentRepliesHandler(rec, asUser(httptest.NewRequest(http.MethodGet, url, nil), tc.viewer))
+
+			want := http.StatusNotFound
+			if tc.want {
+				want = http.StatusOK
+			}
+			if rec.Code != want {
+				t.Fatalf("status %d, want %d", rec.Code, want)
+			}
+			if tc.want {
+				var page struct {
+					Replies []commentDTO `json:"replies"`
+				}
+				if err := json.NewDecoder(rec.Body).Decode(&page); err != nil || len(page.Replies) != 1 {
+					t.Errorf("got %d replies (%v), want 1", len(page.Replies), err)
+				}
+			}
+		})
+	}
+}
+
+func TestFeedListsOnlyVisiblePosts(t *testing.T) {
+	setupVisibilityDB(t)
+	for _, viewer := range []int64{anonymous, author, follower, picked, stranger} {
+		var want []int64
+		for _, tc := range visibilityCases {
+			if tc.viewer == viewer && tc.want {
+				want = append(want, tc.postID)
+			}
+		}
+
+		rec := httptest.NewRecorder()
+		ListFeedHandler(rec, asUser(httptest.NewRequest(http.MethodGet, "/api/posts?user_id=1", nil), viewer))
+		var page struct {
+			Posts []feedPost `json:"posts"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&page); err != nil {
+			t.Fatalf("viewer %d: %v", viewer, err)
+		}
+		got := map[int64]bool{}
+		for _, p := range page.Posts {
+			got[p.ID] = true
+		}
+		if len(got) != len(want) {
+			t.Errorf("viewer %d sees %v, want %v", viewer, got, want)
+			continue
+		}
+		for _, id := range want {
+			if !got[id] {
+				t.Errorf("viewer %d doesn't see post %d", viewer, id)
+			}
+		}
+	}
+}
+
+func TestGetPostHonorsPrivacy(t *testing.T) {
+	setupVisibilityDB(t)
+	for _, tc := range visibilityCases {
+		t.Run(tc.name, func(t *testing.T) {
+			url := "/api/posts/" + strconv.FormatInt(tc.postID, 10)
+			rec := httptest.NewRecorder()
+			GetPostHandler(rec, asUser(httptest.NewRequest(http.MethodGet, url, nil), tc.viewer))
+
+			if !tc.want {
+				if rec.Code != http.StatusNotFound {
+					t.Errorf("status %d, want 404", rec.Code)
+				}
+				return
+			}
+			var p feedPost
+			if err := json.NewDecoder(rec.Body).Decode(&p); err != nil || rec.Code != http.StatusOK || p.ID != tc.postID {
+				t.Errorf("status %d, post %d (%v); want 200 and post %d", rec.Code, p.ID, err, tc.postID)
+			}
+		})
+	}
+}
+
+func TestSharePreviewOnlyForPublicPosts(t *testing.T) {
+	setupVisibilityDB(t)
+	for _, id := range []int64{publicPost, followersPost, privatePost} {
+		_, ok := loadSharePreview("/posts/" + strconv.FormatInt(id, 10))
+		if want := id == publicPost; ok != want {
+			t.Errorf("preview for post %d: %v, want %v", id, ok, want)
+		}
+	}
+}
+
+func TestPostRevisionsOnlyForAuthor(t *testing.T) {
+	setupVisibilityDB(t)
+	// the private post used to have another audience
+	if _, err := db.DB.Exec("INSERT INTO post_revisions (post_id, content, privacy, replaced_at) VALUES (?, 'for someone else', 'private', CURRENT_TIMESTAMP)", privatePost); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range visibilityCases {
+		if tc.postID != privatePost {
+			continue
+		}
+		t.Run(tc.name, func(t *testing.T) {
+			url := "/api/posts/revisions?post_id=" + strconv.FormatInt(privatePost, 10)
+			rec := httptest.NewRecorder()
+			PostRevisionsHandler(rec, asUser(httptest.NewRequest(http.MethodGet, url, nil), tc.viewer))
+
+			want := http.StatusNotFound
+			switch {
+			case tc.viewer == author:
+				want = http.StatusOK
+			case tc.want:
+				want = http.StatusForbidden
+			}
+			if rec.Code != want {
+				t.Errorf("status %d, want %d", rec.Code, want)
+			}
+			if tc.viewer != author && strings.Contains(rec.Body.String(), "for someone else") {
+				t.Error("revision content leaked")
+			}
+		})
+	}
+}
@@ -6,8 +6,11 @@ import (
 	"time"
 
 	"social-network/backend/bus"
+	"social-network/backend/config"
 	"social-network/backend/db"
 	"social-network/backend/handlers"
+	"social-network/backend/mailer"
+	"social-network/backend/ratelimit"
 	"social-network/backend/utils"
 	"strconv"
 
@@ -15,21 +18,62 @@ import (
 )
 
 func main() {
+	config.Load()
 	db.InitDB() // connect + run migrations
 	// inject DB into utils package for session helpers
 	utils.SetDB(db.DB)
+	// first admin(s) come from ADMIN_EMAILS
+	handlers.BootstrapAdmins()
+	// outgoing mail (password resets etc.) goes through the configured driver
+	mailer.Set(mailer.FromConfig(config.Current))
+
+	// login throttling; the sqlite store keeps lockouts across restarts
+	var limiterStore ratelimit.Store = ratelimit.NewMemoryStore()
+	if config.Current.RateLimitStore == "sqlite" {
+		limiterStore = ratelimit.NewSQLiteStore(db.DB)
+	}
+	ratelimit.Set(ratelimit.New(limiterStore, ratelimit.LockoutPolicy{
+		MaxFailures: config.Current.LoginMaxFailures,
+		Window:      15 * time.Minute,
+		Base:        config.Current.LoginLockoutBase,
+		Max:         config.Current.LoginLockoutMax,
+	}))
+
+	// keys for API access tokens; configure JWT_KEYS so tokens survive restarts
+	var jwtKeys []*utils.JWTKey
+	for _, spec := range config.Current.JWTKeys {
+		key, err := utils.ParseJWTKey(spec)
+		if err != nil {
+			log.Fatal(err)
+		}
+		jwtKeys = append(jwtKeys, key)
+	}
+	var keySet *utils.JWTKeySet
+	var err error
+	if len(jwtKeys) > 0 {
+		keySet, err = utils.NewJWTKeySet(jwtKeys, config.Current.JWTSigningKey)
+	} else {
+		log.Println("JWT_KEYS not set, using an ephemeral key; access tokens won't survive a restart")
+		keySet, err = utils.GenerateJWTKeySet()
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	utils.SetJWTKeys(keySet)
 
 	mux := http.NewServeMux()
 	RegisterRoutes(mux)
 
 	// CORS handler
 	c := cors.New(cors.Options{
-		AllowedOrigins:   []string{"http://localhost:5173", "http://localhost:5174"},
+		AllowedOrigins:   config.Current.AllowedOrigins,
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"Content-Type", "Authorization"},
 		AllowCredentials: true,
 	})
-	handler := c.Handler(mux)
+	handler := c.Handler(CSRFProtect(mux))
+
+	handlers.StartTimelineWorker()
 
 	// Start periodic session cleanup
 	go func() {
@@ -37,9 +81,23 @@ func main() {
 		defer ticker.Stop()
 		for range ticker.C {
 			handlers.CleanupSessions()
+			handlers.CleanupDataExports()
+			ratelimit.Default().Prune(24 * time.Hour)
 		}
 	}()
 
+	// Permanently remove accounts whose deletion grace period has passed
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for {
+			handlers.PurgeDeletedAccounts()
+			<-ticker.C
+		}
+	}()
+
+	bus.SetDisconnectHandler(disconnectClient)
+
 	// Start bus forwarder: listen for notification messages and send to WS clients
 	go func() {
 		for nm := range bus.NotificationChan {
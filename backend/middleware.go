@@ -1,37 +1,309 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"log"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
+	"social-network/backend/config"
 	"social-network/backend/db"
+	"social-network/backend/handlers"
+	"social-network/backend/ratelimit"
 	"social-network/backend/utils"
 )
 
-// AuthMiddleware validates the session cookie and places the user ID into the request context.
+// lastSeenResolution limits how often a session's last_seen_at is rewritten.
+const lastSeenResolution = time.Minute
+
+// AuthMiddleware validates the session cookie, or a bearer access token, and
+// places the user ID into the request context. Personal access tokens are
+// refused; routes open to them are registered with ScopedAuth instead.
 func AuthMiddleware(next http.Handler) http.Handler {
+	return ScopedAuth("", next)
+}
+
+// OptionalAuth is for public routes that show more to signed-in users. A
+// request with a bearer token is authenticated like ScopedAuth, so personal
+// access tokens granted scope read as their user; anything else goes through
+// as is, and the handler looks up the session cookie itself.
+func OptionalAuth(scope string, next http.Handler) http.Handler {
+	scoped := ScopedAuth(scope, next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if utils.BearerToken(r) != "" {
+			scoped.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ScopedAuth is AuthMiddleware for routes that personal access tokens may
+// use, provided the token was granted scope. Several space-separated scopes
+// are all required.
+func ScopedAuth(scope string, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token := utils.BearerToken(r); strings.HasPrefix(token, handlers.PersonalTokenPrefix) {
+			if scope == "" {
+				utils.Error(w, http.StatusForbidden, "Personal access tokens can't be used for this endpoint")
+				return
+			}
+			userID, err := handlers.AuthenticatePersonalToken(token, scope)
+			if err == handlers.ErrTokenScope {
+				w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="`+scope+`"`)
+				utils.Error(w, http.StatusForbidden, "Token needs the scope "+scope)
+				return
+			}
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			if rejectSuspended(w, userID) {
+				return
+			}
+			ctx := context.WithValue(r.Context(), utils.UserIDKey, strconv.FormatInt(userID, 10))
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
+		// API clients send a signed access token. Its session must still
+		// exist, so signing out, a password reset or a forced logout revoke
+		// it right away, as do suspensions.
+		if token := utils.BearerToken(r); token != "" {
+			claims, err := utils.ParseAccessToken(token)
+			if err == nil && !utils.SessionActive(claims.UserID(), claims.SessionID) {
+				err = utils.ErrInvalidToken
+			}
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			if rejectSuspended(w, claims.UserID()) {
+				return
+			}
+			ctx := context.WithValue(r.Context(), utils.UserIDKey, claims.Subject)
+			ctx = context.WithValue(ctx, utils.SessionIDKey, claims.SessionID)
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
 		cookie, err := r.Cookie("session_token")
 		if err != nil {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
 
-		var userIDInt int64
+		var sessionID, userIDInt int64
 		var expiry time.Time
-		err = db.DB.QueryRow("SELECT user_id, expiry FROM sessions WHERE cookie_token = ?", cookie.Value).
-			Scan(&userIDInt, &expiry)
+		var lastSeen sql.NullTime
+		err = db.DB.QueryRow("SELECT id, user_id, expiry, last_seen_at FROM sessions WHERE cookie_token = ?", cookie.Value).
+			Scan(&sessionID, &userIDInt, &expiry, &lastSeen)
 		if err != nil || time.Now().After(expiry) {
 			// remove cookie client-side
-			http.SetCookie(w, &http.Cookie{Name: "session_token", Value: "", Path: "/", Expires: time.Unix(0, 0), MaxAge: -1})
+			utils.ExpireSessionCookie(w)
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
 
+		if rejectSuspended(w, userIDInt) {
+			return
+		}
+
+		// refresh last-seen, but not on every single request
+		if now := time.Now(); !lastSeen.Valid || now.Sub(lastSeen.Time) > lastSeenResolution {
+			db.DB.Exec("UPDATE sessions SET last_seen_at = ? WHERE id = ?", now, sessionID)
+		}
+
 		// store user id as string in context for consistency with handlers
 		ctx := context.WithValue(r.Context(), utils.UserIDKey, strconv.FormatInt(userIDInt, 10))
+		ctx = context.WithValue(ctx, utils.SessionIDKey, sessionID)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// rejectSuspended answers with 403 if the user is currently suspended.
+func rejectSuspended(w http.ResponseWriter, userID int64) bool {
+	s := handlers.ActiveSuspension(userID)
+	if s == nil {
+		return false
+	}
+	handlers.WriteSuspended(w, s)
+	return true
+}
+
+// RequireVerified blocks the wrapped handler for users whose email is not yet
+// verified when the configured policy restricts the given action. It must be
+// nested inside AuthMiddleware.
+func RequireVerified(action string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := strconv.ParseInt(utils.GetUserIDFromContext(r), 10, 64)
+		if handlers.VerificationRequired(userID, action) {
+			utils.Error(w, http.StatusForbidden, "Please verify your email address first")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireRole restricts the wrapped handler to users whose global role is at
+// least min. It must be nested inside AuthMiddleware.
+func RequireRole(min string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := strconv.ParseInt(utils.GetUserIDFromContext(r), 10, 64)
+		if !handlers.HasRole(userID, min) {
+			utils.Error(w, http.StatusForbidden, "Forbidden")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Token buckets for the credential endpoints: a generous allowance per client
+// IP plus a tighter one per account identifier, so one attacker can't spray a
+// single account from many addresses nor many accounts from one address.
+var (
+	authIPRule         = ratelimit.Rule{Burst: 20, Every: 6 * time.Second}
+	authIdentifierRule = ratelimit.Rule{Burst: 5, Every: 30 * time.Second}
+)
+
+// RateLimitAuth throttles an unauthenticated credential endpoint. scope keeps
+// the buckets of different endpoints apart. The identifier is taken from the
+// JSON body ("identifier" or "email"); the body is restored for the handler.
+// Identifiers locked out after repeated failed passwords are rejected too.
+func RateLimitAuth(scope string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			next.ServeHTTP(w, r)
+			return
+		}
+		limiter := ratelimit.Default()
+
+		if ok, wait := limiter.Allow(scope+":ip:"+utils.ClientIP(r), authIPRule); !ok {
+			utils.TooManyRequests(w, wait)
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+		if err != nil {
+			utils.Error(w, http.StatusBadRequest, "Invalid input")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		var creds struct {
+			Identifier string `json:"identifier"`
+			Email      string `json:"email"`
+		}
+		json.Unmarshal(body, &creds)
+		identifier := strings.ToLower(strings.TrimSpace(creds.Identifier))
+		if identifier == "" {
+			identifier = strings.ToLower(strings.TrimSpace(creds.Email))
+		}
+		if identifier == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if wait := limiter.Locked(ratelimit.LockoutKey(identifier, utils.ClientIP(r))); wait > 0 {
+			utils.TooManyRequests(w, wait)
+			return
+		}
+		if ok, wait := limiter.Allow(scope+":id:"+identifier, authIdentifierRule); !ok {
+			utils.TooManyRequests(w, wait)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// CSRFProtect rejects cross-site state-changing requests. Requests
+// authenticated with an Authorization header can't be forged by another site
+// and pass through; for everything else the Origin (or, failing that, Referer)
+// must be the backend itself or one of config.AllowedOrigins. A request with
+// neither header is only let through when it carries no session cookie, so
+// non-browser clients keep working.
+func CSRFProtect(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if config.Current.CSRFProtection == "off" || !stateChanging(r.Method) || r.Header.Get("Authorization") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		// set by browsers that support it; "none" is a user-initiated navigation
+		switch r.Header.Get("Sec-Fetch-Site") {
+		case "same-origin", "none":
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		origin := r.Header.Get("Origin")
+		if origin == "" || origin == "null" {
+			if ref, err := url.Parse(r.Header.Get("Referer")); err == nil && ref.Host != "" {
+				origin = ref.Scheme + "://" + ref.Host
+			}
+		}
+		if origin == "" || origin == "null" {
+			if _, err := r.Cookie("session_token"); err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			utils.Error(w, http.StatusForbidden, "Missing request origin")
+			return
+		}
+		if !originAllowed(r, origin, config.Current.AllowedOrigins) {
+			log.Printf("Blocked cross-site %s %s from origin %s", r.Method, r.URL.Path, origin)
+			utils.Error(w, http.StatusForbidden, "Cross-site request blocked")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func stateChanging(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return false
+	}
+	return true
+}
+
+// originAllowed reports whether origin is the backend's own origin or is in
+// allowed, which may contain "*" to allow any origin.
+func originAllowed(r *http.Request, origin string, allowed []string) bool {
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	origin = strings.ToLower(u.Scheme + "://" + u.Host)
+	for _, a := range allowed {
+		if a == "*" || strings.TrimRight(a, "/") == origin {
+			return true
+		}
+	}
+	return false
+}
+
+// checkWSOrigin is the WebSocket upgrader's origin check. Clients that send no
+// Origin (i.e. not browsers) are allowed; they still have to authenticate.
+func checkWSOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if originAllowed(r, origin, config.Current.WSAllowedOrigins) {
+		return true
+	}
+	log.Printf("Rejected WebSocket upgrade from origin %s", origin)
+	return false
+}
@@ -1,6 +1,9 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // Register and responses
 type RegisterRequest struct {
@@ -13,6 +16,7 @@ type RegisterRequest struct {
 	Avatar      string `json:"avatar"`
 	About       string `json:"about_me"`
 	ProfileType string `json:"profile_type"`
+	InviteCode  string `json:"invite_code"`
 }
 
 type RegisterResponse struct {
@@ -25,7 +29,24 @@ type LoginRequest struct {
 }
 
 type LoginResponse struct {
-	UserID string `json:"user_id"`
+	UserID string `json:"user_id,omitempty"`
+	// Set instead of UserID when the account has 2FA enabled; the client
+	// completes the login by posting the challenge and a code to /login/mfa.
+	MFARequired  bool   `json:"mfa_required,omitempty"`
+	MFAChallenge string `json:"mfa_challenge,omitempty"`
+	ExpiresIn    int    `json:"expires_in,omitempty"`
+	// True when this login called off a scheduled account deletion.
+	DeletionCancelled bool `json:"deletion_cancelled,omitempty"`
+}
+
+// TokenResponse is returned to API clients by /api/token and /api/token/refresh.
+type TokenResponse struct {
+	AccessToken       string `json:"access_token"`
+	TokenType         string `json:"token_type"`
+	ExpiresIn         int    `json:"expires_in"`
+	RefreshToken      string `json:"refresh_token"`
+	UserID            string `json:"user_id"`
+	DeletionCancelled bool   `json:"deletion_cancelled,omitempty"`
 }
 
 // Shared Models
@@ -66,8 +87,6 @@ type Comment struct {
 	CreatedAtHuman string    `json:"created_at"`
 	Nickname       string    `json:"nickname"`
 	ReplyCount     int       `json:"reply_count"`
-	LikeCount      int       `json:"like_count"`
-	DislikeCount   int       `json:"dislike_count"`
 	Replies        []Comment `json:"replies,omitempty"`
 }
 
@@ -94,13 +113,73 @@ type Message struct {
 	SenderName string    `json:"sender_name"`
 	ReceiverID string    `json:"receiver_id"`
 	CreatedAt  time.Time `json:"created_at"`
+	Mentions   []Mention `json:"mentions,omitempty"`
+}
+
+// Mention is an @nickname in a piece of content, resolved to a user. Start
+// and End are UTF-16 offsets into the content, as JavaScript indexes strings.
+type Mention struct {
+	UserID   int64  `json:"user_id"`
+	Nickname string `json:"nickname"`
+	Start    int    `json:"start"`
+	End      int    `json:"end"`
 }
 
 type Session struct {
 	ID          int64     `json:"id"`
 	UserID      int64     `json:"user_id"`
-	CookieToken string    `json:"cookie_token"`
+	CookieToken string    `json:"-"` // never echo the token back to clients
 	Expiry      time.Time `json:"expiry"`
+	UserAgent   string    `json:"user_agent"`
+	IPAddress   string    `json:"ip_address"`
+	CreatedAt   time.Time `json:"created_at"`
+	LastSeenAt  time.Time `json:"last_seen_at"`
+	Current     bool      `json:"current"`
+}
+
+// PersonalAccessToken describes a user-created API token. The token itself is
+// only returned once, when it is created.
+type PersonalAccessToken struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Token      string     `json:"token,omitempty"`
+}
+
+// AuditEntry is one record of the security audit log.
+type AuditEntry struct {
+	ID        int64           `json:"id"`
+	UserID    int64           `json:"user_id,omitempty"`
+	ActorID   int64           `json:"actor_id,omitempty"`
+	Action    string          `json:"action"`
+	IPAddress string          `json:"ip_address"`
+	UserAgent string          `json:"user_agent"`
+	Data      json.RawMessage `json:"data,omitempty"`
+	CreatedAt string          `json:"created_at"`
+	Hash      string          `json:"hash"`
+}
+
+// InviteCode is a registration invite. UsedBy lists the users who signed up with it.
+type InviteCode struct {
+	ID        int64          `json:"id"`
+	Code      string         `json:"code"`
+	CreatedBy int64          `json:"created_by,omitempty"`
+	MaxUses   int            `json:"max_uses"`
+	Uses      int            `json:"uses"`
+	ExpiresAt time.Time      `json:"expires_at"`
+	RevokedAt *time.Time     `json:"revoked_at"`
+	CreatedAt time.Time      `json:"created_at"`
+	UsedBy    []InviteSignup `json:"used_by"`
+}
+
+// InviteSignup is a user who registered with an invite code.
+type InviteSignup struct {
+	UserID   int64  `json:"user_id"`
+	Nickname string `json:"nickname"`
 }
 
 type Follower struct {
@@ -0,0 +1,68 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps limiter state in process memory. State is lost on restart.
+type MemoryStore struct {
+	mu       sync.Mutex
+	buckets  map[string]Bucket
+	lockouts map[string]Lockout
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets:  make(map[string]Bucket),
+		lockouts: make(map[string]Lockout),
+	}
+}
+
+func (s *MemoryStore) UpdateBucket(key string, fn func(b *Bucket)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b := s.buckets[key]
+	fn(&b)
+	s.buckets[key] = b
+	return nil
+}
+
+func (s *MemoryStore) UpdateLockout(key string, fn func(l *Lockout)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l := s.lockouts[key]
+	fn(&l)
+	s.lockouts[key] = l
+	return nil
+}
+
+func (s *MemoryStore) GetLockout(key string) (Lockout, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lockouts[key], nil
+}
+
+func (s *MemoryStore) DeleteLockout(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.lockouts, key)
+	return nil
+}
+
+func (s *MemoryStore) Prune(before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, b := range s.buckets {
+		if b.Updated.Before(before) {
+			delete(s.buckets, k)
+		}
+	}
+	for k, l := range s.lockouts {
+		if l.LastFailure.Before(before) && l.LockedUntil.Before(before) {
+			delete(s.lockouts, k)
+		}
+	}
+	return nil
+}
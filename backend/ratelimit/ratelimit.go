@@ -0,0 +1,168 @@
+package ratelimit
+
+// Token-bucket rate limiting plus progressive lockout after repeated failures.
+// The algorithm lives in Limiter; where the state is kept is up to the Store,
+// so the in-memory default can be swapped for SQLiteStore to survive restarts.
+
+import (
+	"log"
+	"math"
+	"strings"
+	"time"
+)
+
+// Rule describes a token bucket: up to Burst requests at once, refilled at
+// one token per Every.
+type Rule struct {
+	Burst int
+	Every time.Duration
+}
+
+// Bucket is the persisted state of one token bucket.
+type Bucket struct {
+	Tokens  float64
+	Updated time.Time
+}
+
+// Lockout is the persisted failure state of one identifier.
+type Lockout struct {
+	Failures    int
+	LastFailure time.Time
+	LockedUntil time.Time
+}
+
+// Store keeps bucket and lockout state. The update functions must run fn
+// atomically with respect to other updates of the same key; fn receives the
+// zero value when the key has no state yet.
+type Store interface {
+	UpdateBucket(key string, fn func(b *Bucket)) error
+	UpdateLockout(key string, fn func(l *Lockout)) error
+	GetLockout(key string) (Lockout, error)
+	DeleteLockout(key string) error
+	// Prune drops state that hasn't been touched since before.
+	Prune(before time.Time) error
+}
+
+// LockoutPolicy controls progressive lockout: after MaxFailures failed
+// attempts within Window the identifier is locked for Base, doubling with each
+// further failure up to Max.
+type LockoutPolicy struct {
+	MaxFailures int
+	Window      time.Duration
+	Base        time.Duration
+	Max         time.Duration
+}
+
+// Limiter applies rules and lockouts on top of a Store.
+type Limiter struct {
+	store  Store
+	policy LockoutPolicy
+	now    func() time.Time
+}
+
+// New returns a Limiter backed by store.
+func New(store Store, policy LockoutPolicy) *Limiter {
+	return &Limiter{store: store, policy: policy, now: time.Now}
+}
+
+// Allow takes one token from the bucket identified by key. When the bucket is
+// empty it returns false and how long until the next token is available.
+// Store errors fail open so an outage doesn't lock everyone out.
+func (l *Limiter) Allow(key string, rule Rule) (bool, time.Duration) {
+	now := l.now()
+	allowed := true
+	var wait time.Duration
+	err := l.store.UpdateBucket(key, func(b *Bucket) {
+		if b.Updated.IsZero() {
+			b.Tokens = float64(rule.Burst)
+		} else {
+			elapsed := now.Sub(b.Updated)
+			b.Tokens = math.Min(float64(rule.Burst), b.Tokens+float64(elapsed)/float64(rule.Every))
+		}
+		b.Updated = now
+		if b.Tokens >= 1 {
+			b.Tokens--
+			return
+		}
+		allowed = false
+		wait = time.Duration((1 - b.Tokens) * float64(rule.Every))
+	})
+	if err != nil {
+		log.Printf("rate limit store error for %s: %v", key, err)
+		return true, 0
+	}
+	return allowed, wait
+}
+
+// Locked reports how much longer key is locked out, or 0 if it isn't.
+func (l *Limiter) Locked(key string) time.Duration {
+	lo, err := l.store.GetLockout(key)
+	if err != nil {
+		log.Printf("rate limit store error for %s: %v", key, err)
+		return 0
+	}
+	if remaining := lo.LockedUntil.Sub(l.now()); remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+// Fail records a failed attempt for key and returns the lockout it triggered (0 if none).
+func (l *Limiter) Fail(key string) time.Duration {
+	now := l.now()
+	var lockFor time.Duration
+	err := l.store.UpdateLockout(key, func(lo *Lockout) {
+		// old failures expire once the window has passed without a lock in force
+		if now.Sub(lo.LastFailure) > l.policy.Window && now.After(lo.LockedUntil) {
+			lo.Failures = 0
+		}
+		lo.Failures++
+		lo.LastFailure = now
+		if over := lo.Failures - l.policy.MaxFailures; over >= 0 {
+			lockFor = l.policy.Base << uint(min(over, 30))
+			if lockFor > l.policy.Max || lockFor <= 0 {
+				lockFor = l.policy.Max
+			}
+			lo.LockedUntil = now.Add(lockFor)
+		}
+	})
+	if err != nil {
+		log.Printf("rate limit store error for %s: %v", key, err)
+		return 0
+	}
+	return lockFor
+}
+
+// Reset clears the failure history of key, e.g. after a successful login.
+func (l *Limiter) Reset(key string) {
+	if err := l.store.DeleteLockout(key); err != nil {
+		log.Printf("rate limit store error for %s: %v", key, err)
+	}
+}
+
+// Prune drops state untouched for longer than maxAge.
+func (l *Limiter) Prune(maxAge time.Duration) {
+	if err := l.store.Prune(l.now().Add(-maxAge)); err != nil {
+		log.Printf("rate limit prune error: %v", err)
+	}
+}
+
+// LockoutKey is the lockout key for a login identifier (email or nickname)
+// tried from a client address. Failures from one address don't lock the
+// account for everyone else; the per-identifier bucket in RateLimitAuth
+// still limits guessing from many addresses.
+func LockoutKey(identifier, ip string) string {
+	return "lockout:" + strings.ToLower(strings.TrimSpace(identifier)) + "|" + ip
+}
+
+var current = New(NewMemoryStore(), LockoutPolicy{MaxFailures: 5, Window: 15 * time.Minute, Base: 30 * time.Second, Max: time.Hour})
+
+// Set replaces the package-level limiter used by handlers and middleware.
+func Set(l *Limiter) {
+	current = l
+}
+
+// Default returns the package-level limiter.
+func Default() *Limiter {
+	return current
+}
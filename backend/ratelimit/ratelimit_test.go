@@ -0,0 +1,154 @@
+package ratelimit
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// clock is a time source the tests move by hand.
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time          { return c.t }
+func (c *clock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+// stores returns a fresh instance of every Store, so each behaviour is
+// checked against both.
+func stores(t *testing.T) map[string]Store {
+	t.Helper()
+	conn, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	schema, err := os.ReadFile(filepath.Join("..", "db", "migrations", "sqlite", "000017_create_rate_limits.up.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Exec(string(schema)); err != nil {
+		t.Fatal(err)
+	}
+	return map[string]Store{"memory": NewMemoryStore(), "sqlite": NewSQLiteStore(conn)}
+}
+
+func newTestLimiter(store Store, policy LockoutPolicy) (*Limiter, *clock) {
+	c := &clock{t: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	l := New(store, policy)
+	l.now = c.now
+	return l, c
+}
+
+func TestAllowRefillsBucket(t *testing.T) {
+	rule := Rule{Burst: 3, Every: 10 * time.Second}
+	// each step advances the clock, then asks for a token
+	steps := []struct {
+		advance  time.Duration
+		want     bool
+		wantWait time.Duration
+	}{
+		{0, true, 0}, // a new bucket starts full
+		{0, true, 0},
+		{0, true, 0},
+		{0, false, 10 * time.Second}, // empty
+		{4 * time.Second, false, 6 * time.Second},
+		{6 * time.Second, true, 0}, // one token back
+		{0, false, 10 * time.Second},
+		{time.Hour, true, 0}, // refilled, but never past the burst
+		{0, true, 0},
+		{0, true, 0},
+		{0, false, 10 * time.Second},
+	}
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			l, c := newTestLimiter(store, LockoutPolicy{})
+			for i, s := range steps {
+				c.advance(s.advance)
+				ok, wait := l.Allow("ip:1", rule)
+				if ok != s.want || (wait-s.wantWait).Abs() > time.Millisecond {
+					t.Fatalf("step %d: Allow = %v, %v; want %v, %v", i, ok, wait, s.want, s.wantWait)
+				}
+			}
+			// other keys have their own bucket
+			if ok, _ := l.Allow("ip:2", rule); !ok {
+				t.Error("a different key was limited")
+			}
+		})
+	}
+}
+
+func TestFailEscalatesLockout(t *testing.T) {
+	policy := LockoutPolicy{MaxFailures: 3, Window: 15 * time.Minute, Base: 30 * time.Second, Max: 5 * time.Minute}
+	// each step advances the clock, then records a failure
+	steps := []struct {
+		advance  time.Duration
+		wantLock time.Duration
+	}{
+		{0, 0},
+		{time.Second, 0},
+		{time.Second, 30 * time.Second}, // third failure locks
+		{time.Minute, time.Minute},      // and every later one doubles it
+		{2 * time.Minute, 2 * time.Minute},
+		{3 * time.Minute, 4 * time.Minute},
+		{5 * time.Minute, 5 * time.Minute}, // up to Max
+		{6 * time.Minute, 5 * time.Minute},
+		// a quiet window after the lock ran out starts over
+		{time.Hour, 0},
+	}
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			l, c := newTestLimiter(store, policy)
+			key := LockoutKey(" Alice@Example.com ", "203.0.113.7")
+			for i, s := range steps {
+				c.advance(s.advance)
+				if got := l.Fail(key); got != s.wantLock {
+					t.Fatalf("step %d: Fail = %v, want %v", i, got, s.wantLock)
+				}
+				if got := l.Locked(key); got != s.wantLock {
+					t.Fatalf("step %d: Locked = %v, want %v", i, got, s.wantLock)
+				}
+			}
+		})
+	}
+}
+
+func TestLockoutExpiresAndResets(t *testing.T) {
+	policy := LockoutPolicy{MaxFailures: 2, Window: time.Minute, Base: 30 * time.Second, Max: time.Hour}
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			l, c := newTestLimiter(store, policy)
+			key := LockoutKey("bob", "203.0.113.7")
+			l.Fail(key)
+			l.Fail(key)
+			c.advance(20 * time.Second)
+			if got := l.Locked(key); got != 10*time.Second {
+				t.Fatalf("Locked = %v, want 10s left", got)
+			}
+			if LockoutKey("BOB ", "203.0.113.7") != key {
+				t.Error("lockout keys depend on case or spacing")
+			}
+			if got := l.Locked(LockoutKey("bob", "198.51.100.1")); got != 0 {
+				t.Errorf("another address is locked out for %v", got)
+			}
+			c.advance(10 * time.Second)
+			if got := l.Locked(key); got != 0 {
+				t.Fatalf("Locked = %v after the lock ran out", got)
+			}
+			// still inside the window, so the next failure locks for longer
+			if got := l.Fail(key); got != time.Minute {
+				t.Fatalf("Fail = %v, want 1m", got)
+			}
+			// a successful login wipes the history
+			l.Reset(key)
+			if got := l.Locked(key); got != 0 {
+				t.Fatalf("Locked = %v after Reset", got)
+			}
+			if got := l.Fail(key); got != 0 {
+				t.Errorf("first failure after Reset locked for %v", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package ratelimit
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// SQLiteStore keeps limiter state in the rate_limit_buckets and
+// rate_limit_lockouts tables so lockouts survive a restart. Updates are
+// serialised in-process, which is enough for the single backend instance.
+type SQLiteStore struct {
+	db *sql.DB
+	mu sync.Mutex
+}
+
+// NewSQLiteStore returns a store using the given database.
+func NewSQLiteStore(db *sql.DB) *SQLiteStore {
+	return &SQLiteStore{db: db}
+}
+
+func (s *SQLiteStore) UpdateBucket(key string, fn func(b *Bucket)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var b Bucket
+	var updated sql.NullTime
+	err := s.db.QueryRow("SELECT tokens, updated_at FROM rate_limit_buckets WHERE key = ?", key).Scan(&b.Tokens, &updated)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	b.Updated = updated.Time
+	fn(&b)
+	_, err = s.db.Exec(`INSERT INTO rate_limit_buckets (key, tokens, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT(key) DO UPDATE SET tokens = excluded.tokens, updated_at = excluded.updated_at`,
+		key, b.Tokens, b.Updated)
+	return err
+}
+
+func (s *SQLiteStore) UpdateLockout(key string, fn func(l *Lockout)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l, err := s.getLockout(key)
+	if err != nil {
+		return err
+	}
+	fn(&l)
+	_, err = s.db.Exec(`INSERT INTO rate_limit_lockouts (key, failures, last_failure_at, locked_until) VALUES (?, ?, ?, ?)
+		ON CONFLICT(key) DO UPDATE SET failures = excluded.failures, last_failure_at = excluded.last_failure_at, locked_until = excluded.locked_until`,
+		key, l.Failures, l.LastFailure, l.LockedUntil)
+	return err
+}
+
+func (s *SQLiteStore) GetLockout(key string) (Lockout, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.getLockout(key)
+}
+
+func (s *SQLiteStore) getLockout(key string) (Lockout, error) {
+	var l Lockout
+	var last, until sql.NullTime
+	err := s.db.QueryRow("SELECT failures, last_failure_at, locked_until FROM rate_limit_lockouts WHERE key = ?", key).
+		Scan(&l.Failures, &last, &until)
+	if err == sql.ErrNoRows {
+		return Lockout{}, nil
+	}
+	l.LastFailure = last.Time
+	l.LockedUntil = until.Time
+	return l, err
+}
+
+func (s *SQLiteStore) DeleteLockout(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.db.Exec("DELETE FROM rate_limit_lockouts WHERE key = ?", key)
+	return err
+}
+
+func (s *SQLiteStore) Prune(before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.db.Exec("DELETE FROM rate_limit_buckets WHERE updated_at < ?", before); err != nil {
+		return err
+	}
+	_, err := s.db.Exec("DELETE FROM rate_limit_lockouts WHERE last_failure_at < ? AND locked_until < ?", before, before)
+	return err
+}
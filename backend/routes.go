@@ -16,49 +16,98 @@ func RegisterRoutes(mux *http.ServeMux) {
 	}
 
 	// Serve API, websocket, upload routes etc. (your existing handlers)
-	mux.Handle("/ws", AuthMiddleware(http.HandlerFunc(HandleWebSocket)))
-	mux.Handle("/api/messages/history", AuthMiddleware(http.HandlerFunc(handlers.GetMessageHistory)))
-	mux.HandleFunc("/register", handlers.RegisterHandler)
-	mux.HandleFunc("/login", handlers.LoginHandler)
+	mux.Handle("/ws", ScopedAuth("messages:read messages:write", http.HandlerFunc(HandleWebSocket)))
+	mux.Handle("/api/messages/history", ScopedAuth("messages:read", http.HandlerFunc(handlers.GetMessageHistory)))
+	mux.Handle("/register", RateLimitAuth("register", http.HandlerFunc(handlers.RegisterHandler)))
+	mux.Handle("/login", RateLimitAuth("login", http.HandlerFunc(handlers.LoginHandler)))
+	mux.Handle("/login/mfa", RateLimitAuth("login-mfa", http.HandlerFunc(handlers.LoginMFAHandler)))
 	mux.HandleFunc("/logout", handlers.LogoutHandler)
+	mux.Handle("/api/password/forgot", RateLimitAuth("password-forgot", http.HandlerFunc(handlers.ForgotPasswordHandler)))
+	mux.Handle("/api/password/reset", RateLimitAuth("password-reset", http.HandlerFunc(handlers.ResetPasswordHandler)))
+	mux.Handle("/api/token", RateLimitAuth("token", http.HandlerFunc(handlers.TokenHandler)))
+	mux.HandleFunc("/api/token/refresh", handlers.RefreshTokenHandler)
+	mux.HandleFunc("/api/token/revoke", handlers.RevokeTokenHandler)
+	mux.HandleFunc("/.well-known/jwks.json", handlers.JWKSHandler)
+	mux.Handle("/api/tokens", AuthMiddleware(http.HandlerFunc(handlers.PersonalTokensHandler)))
+	mux.Handle("/api/tokens/revoke", AuthMiddleware(http.HandlerFunc(handlers.RevokePersonalTokenHandler)))
+	mux.HandleFunc("/api/email/verify", handlers.VerifyEmailHandler)
+	mux.HandleFunc("/api/registration", handlers.RegistrationInfoHandler)
+	mux.Handle("/api/invites", AuthMiddleware(http.HandlerFunc(handlers.InvitesHandler)))
+	mux.Handle("/api/invites/revoke", AuthMiddleware(http.HandlerFunc(handlers.RevokeInviteHandler)))
+	mux.Handle("/api/email/verify/resend", AuthMiddleware(http.HandlerFunc(handlers.ResendVerificationHandler)))
 	mux.HandleFunc("/api/check-session", handlers.CheckSessionHandler)
-	mux.Handle("/api/follow", AuthMiddleware(http.HandlerFunc(handlers.FollowHandler)))
-	mux.Handle("/api/unfollow", AuthMiddleware(http.HandlerFunc(handlers.UnfollowHandler)))
-	mux.Handle("/api/follow/accept", AuthMiddleware(http.HandlerFunc(handlers.AcceptFollowHandler)))
-	mux.Handle("/api/follow/decline", AuthMiddleware(http.HandlerFunc(handlers.DeclineFollowHandler)))
-	mux.Handle("/api/follow/requests", AuthMiddleware(http.HandlerFunc(handlers.ListRequests)))
-	mux.Handle("/api/follow/status", AuthMiddleware(http.HandlerFunc(handlers.FollowStatusHandler)))
+	mux.Handle("/api/account/password", AuthMiddleware(http.HandlerFunc(handlers.ChangePasswordHandler)))
+	mux.Handle("/api/account/email", AuthMiddleware(http.HandlerFunc(handlers.ChangeEmailHandler)))
+	mux.Handle("/api/account/delete", AuthMiddleware(http.HandlerFunc(handlers.DeleteAccountHandler)))
+	mux.Handle("/api/account/export", AuthMiddleware(http.HandlerFunc(handlers.DataExportHandler)))
+	mux.Handle("/api/account/export/download", AuthMiddleware(http.HandlerFunc(handlers.DownloadDataExportHandler)))
+	mux.Handle("/api/mfa", AuthMiddleware(http.HandlerFunc(handlers.MFAStatusHandler)))
+	mux.Handle("/api/mfa/enroll", AuthMiddleware(http.HandlerFunc(handlers.EnrollMFAHandler)))
+	mux.Handle("/api/mfa/confirm", AuthMiddleware(http.HandlerFunc(handlers.ConfirmMFAHandler)))
+	mux.Handle("/api/mfa/disable", AuthMiddleware(http.HandlerFunc(handlers.DisableMFAHandler)))
+	mux.Handle("/api/mfa/recovery-codes", AuthMiddleware(http.HandlerFunc(handlers.RegenerateRecoveryCodesHandler)))
+	mux.Handle("/api/audit", AuthMiddleware(http.HandlerFunc(handlers.AuditLogHandler)))
+	mux.Handle("/api/sessions", AuthMiddleware(http.HandlerFunc(handlers.ListSessionsHandler)))
+	mux.Handle("/api/sessions/revoke", AuthMiddleware(http.HandlerFunc(handlers.RevokeSessionHandler)))
+	mux.Handle("/api/sessions/revoke-all", AuthMiddleware(http.HandlerFunc(handlers.RevokeAllSessionsHandler)))
+	mux.Handle("/api/follow", ScopedAuth("followers:write", http.HandlerFunc(handlers.FollowHandler)))
+	mux.Handle("/api/unfollow", ScopedAuth("followers:write", http.HandlerFunc(handlers.UnfollowHandler)))
+	mux.Handle("/api/follow/accept", ScopedAuth("followers:write", http.HandlerFunc(handlers.AcceptFollowHandler)))
+	mux.Handle("/api/follow/decline", ScopedAuth("followers:write", http.HandlerFunc(handlers.DeclineFollowHandler)))
+	mux.Handle("/api/follow/requests", ScopedAuth("followers:read", http.HandlerFunc(handlers.ListRequests)))
+	mux.Handle("/api/follow/status", ScopedAuth("followers:read", http.HandlerFunc(handlers.FollowStatusHandler)))
 	mux.HandleFunc("/api/profile/", handlers.GetProfileHandler)
-	mux.Handle("/api/profile/update", AuthMiddleware(http.HandlerFunc(handlers.UpdateProfileHandler)))
-	mux.Handle("/api/profile/followers", AuthMiddleware(http.HandlerFunc(handlers.GetFollowersHandler)))
-	mux.Handle("/api/profile/following", AuthMiddleware(http.HandlerFunc(handlers.GetFollowingHandler)))
-	mux.Handle("/api/profile/privacy", AuthMiddleware(http.HandlerFunc(handlers.TogglePrivacyHandler)))
-	mux.Handle("/api/posts/create", AuthMiddleware(http.HandlerFunc(handlers.CreatePostHandler)))
-	mux.HandleFunc("/api/posts", handlers.ListFeedHandler)
+	mux.Handle("/api/profile/update", ScopedAuth("profile:write", http.HandlerFunc(handlers.UpdateProfileHandler)))
+	mux.Handle("/api/profile/followers", ScopedAuth("followers:read", http.HandlerFunc(handlers.GetFollowersHandler)))
+	mux.Handle("/api/profile/following", ScopedAuth("followers:read", http.HandlerFunc(handlers.GetFollowingHandler)))
+	mux.Handle("/api/profile/privacy", ScopedAuth("profile:write", http.HandlerFunc(handlers.TogglePrivacyHandler)))
+	mux.Handle("/api/posts/create", ScopedAuth("posts:write", RequireVerified("post", http.HandlerFunc(handlers.CreatePostHandler))))
+	mux.Handle("/api/posts", OptionalAuth("posts:read", http.HandlerFunc(handlers.ListFeedHandler)))
+	mux.Handle("/api/posts/update", ScopedAuth("posts:write", RequireVerified("post", http.HandlerFunc(handlers.UpdatePostHandler))))
+	mux.Handle("/api/posts/delete", ScopedAuth("posts:write", http.HandlerFunc(handlers.DeletePostHandler)))
+	mux.Handle("/api/posts/revisions", OptionalAuth("posts:read", http.HandlerFunc(handlers.PostRevisionsHandler)))
+	mux.Handle("/api/posts/", OptionalAuth("posts:read", http.HandlerFunc(handlers.GetPostHandler)))
+	mux.Handle("/api/reactions", ScopedAuth("posts:write", http.HandlerFunc(handlers.ReactionsHandler)))
 	mux.HandleFunc("/api/users", handlers.PublicUsersHandler)
-	mux.Handle("/api/notifications", AuthMiddleware(http.HandlerFunc(handlers.ListNotificationsHandler)))
-	mux.Handle("/api/notifications/mark-read", AuthMiddleware(http.HandlerFunc(handlers.MarkNotificationsReadHandler)))
-	mux.Handle("/api/group/create", AuthMiddleware(http.HandlerFunc(handlers.CreateGroupHandler)))
+	mux.Handle("/api/notifications", ScopedAuth("notifications:read", http.HandlerFunc(handlers.ListNotificationsHandler)))
+	mux.Handle("/api/notifications/mark-read", ScopedAuth("notifications:write", http.HandlerFunc(handlers.MarkNotificationsReadHandler)))
+	mux.Handle("/api/group/create", ScopedAuth("groups:write", RequireVerified("group", http.HandlerFunc(handlers.CreateGroupHandler))))
 	mux.HandleFunc("/api/groups", handlers.ListGroupsHandler)
 	mux.HandleFunc("/api/group", handlers.GetGroupHandler)
-	mux.Handle("/api/group/invite", AuthMiddleware(http.HandlerFunc(handlers.InviteHandler)))
-	mux.Handle("/api/group/invite/respond", AuthMiddleware(http.HandlerFunc(handlers.RespondInviteHandler)))
-	mux.Handle("/api/group/membership", AuthMiddleware(http.HandlerFunc(handlers.CheckMembershipHandler)))
-	mux.Handle("/api/group/request", AuthMiddleware(http.HandlerFunc(handlers.RequestToJoinHandler)))
-	mux.Handle("/api/group/request/respond", AuthMiddleware(http.HandlerFunc(handlers.RespondRequestHandler)))
-	mux.Handle("/api/group/requests", AuthMiddleware(http.HandlerFunc(handlers.ListRequestsHandler)))
-	mux.Handle("/api/group/request/status", AuthMiddleware(http.HandlerFunc(handlers.GetRequestStatusHandler)))
-	mux.Handle("/api/group/post/create", AuthMiddleware(http.HandlerFunc(handlers.CreateGroupPostHandler)))
-	mux.HandleFunc("/api/group/posts", handlers.ListGroupPostsHandler)
-	mux.Handle("/api/group/messages", AuthMiddleware(http.HandlerFunc(handlers.ListGroupMessagesHandler)))
-	mux.Handle("/api/group/comment", AuthMiddleware(http.HandlerFunc(handlers.AddGroupCommentHandler)))
-	mux.Handle("/api/group/comments", AuthMiddleware(http.HandlerFunc(handlers.ListGroupCommentsHandler)))
-	mux.Handle("/api/group/event/create", AuthMiddleware(http.HandlerFunc(handlers.CreateEventHandler)))
-	mux.Handle("/api/group/event/vote", AuthMiddleware(http.HandlerFunc(handlers.VoteEventHandler)))
-	mux.Handle("/api/group/events", AuthMiddleware(http.HandlerFunc(handlers.ListEventsHandler)))
-	mux.Handle("/api/posts/comment", AuthMiddleware(http.HandlerFunc(handlers.AddCommentHandler)))
+	mux.Handle("/api/group/invite", ScopedAuth("groups:write", RequireVerified("group", http.HandlerFunc(handlers.InviteHandler))))
+	mux.Handle("/api/group/invite/respond", ScopedAuth("groups:write", http.HandlerFunc(handlers.RespondInviteHandler)))
+	mux.Handle("/api/group/membership", ScopedAuth("groups:read", http.HandlerFunc(handlers.CheckMembershipHandler)))
+	mux.Handle("/api/group/request", ScopedAuth("groups:write", RequireVerified("group", http.HandlerFunc(handlers.RequestToJoinHandler))))
+	mux.Handle("/api/group/request/respond", ScopedAuth("groups:write", http.HandlerFunc(handlers.RespondRequestHandler)))
+	mux.Handle("/api/group/requests", ScopedAuth("groups:read", http.HandlerFunc(handlers.ListRequestsHandler)))
+	mux.Handle("/api/group/request/status", ScopedAuth("groups:read", http.HandlerFunc(handlers.GetRequestStatusHandler)))
+	mux.Handle("/api/group/post/create", ScopedAuth("groups:write", RequireVerified("post", http.HandlerFunc(handlers.CreateGroupPostHandler))))
+	mux.Handle("/api/group/posts", OptionalAuth("groups:read", http.HandlerFunc(handlers.ListGroupPostsHandler)))
+	mux.Handle("/api/group/messages", ScopedAuth("messages:read", http.HandlerFunc(handlers.ListGroupMessagesHandler)))
+	mux.Handle("/api/group/comment", ScopedAuth("groups:write", RequireVerified("comment", http.HandlerFunc(handlers.AddGroupCommentHandler))))
+	mux.Handle("/api/group/comments", ScopedAuth("groups:read", http.HandlerFunc(handlers.ListGroupCommentsHandler)))
+	mux.Handle("/api/group/comment/replies", ScopedAuth("groups:read", http.HandlerFunc(handlers.GroupCommentRepliesHandler)))
+	mux.Handle("/api/group/comment/update", ScopedAuth("groups:write", http.HandlerFunc(handlers.UpdateGroupCommentHandler)))
+	mux.Handle("/api/group/comment/delete", ScopedAuth("groups:write", http.HandlerFunc(handlers.DeleteGroupCommentHandler)))
+	mux.Handle("/api/group/event/create", ScopedAuth("groups:write", RequireVerified("group", http.HandlerFunc(handlers.CreateEventHandler))))
+	mux.Handle("/api/group/event/vote", ScopedAuth("groups:write", http.HandlerFunc(handlers.VoteEventHandler)))
+	mux.Handle("/api/group/events", ScopedAuth("groups:read", http.HandlerFunc(handlers.ListEventsHandler)))
+	mux.Handle("/api/posts/comment", ScopedAuth("posts:write", RequireVerified("comment", http.HandlerFunc(handlers.AddCommentHandler))))
+	mux.Handle("/api/posts/comment/replies", OptionalAuth("posts:read", http.HandlerFunc(handlers.CommentRepliesHandler)))
+	mux.Handle("/api/posts/comment/update", ScopedAuth("posts:write", http.HandlerFunc(handlers.UpdateCommentHandler)))
+	mux.Handle("/api/posts/comment/delete", ScopedAuth("posts:write", http.HandlerFunc(handlers.DeleteCommentHandler)))
+	mux.Handle("/api/admin/users", AuthMiddleware(RequireRole(handlers.RoleModerator, http.HandlerFunc(handlers.AdminListUsersHandler))))
+	mux.Handle("/api/admin/users/role", AuthMiddleware(RequireRole(handlers.RoleAdmin, http.HandlerFunc(handlers.AdminSetRoleHandler))))
+	mux.Handle("/api/admin/users/suspend", AuthMiddleware(RequireRole(handlers.RoleModerator, http.HandlerFunc(handlers.AdminSuspendUserHandler))))
+	mux.Handle("/api/admin/users/unsuspend", AuthMiddleware(RequireRole(handlers.RoleModerator, http.HandlerFunc(handlers.AdminUnsuspendUserHandler))))
+	mux.Handle("/api/admin/users/logout", AuthMiddleware(RequireRole(handlers.RoleModerator, http.HandlerFunc(handlers.AdminForceLogoutHandler))))
+	mux.Handle("/api/admin/content/delete", AuthMiddleware(RequireRole(handlers.RoleModerator, http.HandlerFunc(handlers.AdminDeleteContentHandler))))
+	mux.Handle("/api/admin/audit", AuthMiddleware(RequireRole(handlers.RoleModerator, http.HandlerFunc(handlers.AdminAuditLogHandler))))
+	mux.Handle("/api/admin/audit/verify", AuthMiddleware(RequireRole(handlers.RoleAdmin, http.HandlerFunc(handlers.AdminVerifyAuditHandler))))
+	mux.Handle("/api/admin/comments/archive", AuthMiddleware(RequireRole(handlers.RoleModerator, http.HandlerFunc(handlers.AdminCommentArchiveHandler))))
+	mux.Handle("/api/admin/stats", AuthMiddleware(RequireRole(handlers.RoleModerator, http.HandlerFunc(handlers.AdminStatsHandler))))
 	mux.Handle("/uploads/", http.StripPrefix("/uploads/", http.FileServer(http.Dir("backend/uploads"))))
-	mux.Handle("/api/upload", AuthMiddleware(http.HandlerFunc(handlers.UploadHandler)))
+	mux.Handle("/api/upload", ScopedAuth("posts:write", http.HandlerFunc(handlers.UploadHandler)))
 
 	// === SPA fallback handler for Vue Router ===
 	fileServer := http.FileServer(http.Dir(staticDir))
@@ -78,8 +127,9 @@ func RegisterRoutes(mux *http.ServeMux) {
 			return
 		}
 
-		// For any other path, serve index.html so the SPA router can take over
-		http.ServeFile(w, r, filepath.Join(staticDir, "index.html"))
+		// For any other path, serve index.html so the SPA router can take over,
+		// with link preview tags for public posts, profiles and groups
+		handlers.ServeIndex(w, r, filepath.Join(staticDir, "index.html"))
 	})
 }
 
@@ -1 +1,259 @@
 package utils
+
+// Signed access tokens (JWT, RFC 7519) for API clients that can't use the
+// session cookie. Only the algorithms we issue are accepted, HS256 and EdDSA
+// (Ed25519), and every token names its key in the "kid" header so keys can be
+// rotated: new tokens are signed with the signing key while tokens signed with
+// older keys stay valid for as long as those keys remain configured.
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidToken is returned for any token that fails parsing, signature or expiry checks.
+var ErrInvalidToken = errors.New("invalid token")
+
+// JWTKey is one signing/verification key.
+type JWTKey struct {
+	ID  string
+	Alg string // "HS256" or "EdDSA"
+
+	secret  []byte             // HS256
+	private ed25519.PrivateKey // EdDSA
+	public  ed25519.PublicKey  // EdDSA
+}
+
+// ParseJWTKey parses a key spec of the form "kid:alg:key". For HS256 the key
+// is the shared secret (at least 32 bytes), for EdDSA the 32-byte Ed25519
+// seed; both base64 encoded (standard or URL alphabet, padding optional).
+func ParseJWTKey(spec string) (*JWTKey, error) {
+	parts := strings.SplitN(strings.TrimSpace(spec), ":", 3)
+	if len(parts) != 3 || parts[0] == "" {
+		return nil, fmt.Errorf("jwt key %q: want kid:alg:base64key", spec)
+	}
+	raw, err := decodeKeyMaterial(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("jwt key %s: %w", parts[0], err)
+	}
+	switch parts[1] {
+	case "HS256":
+		if len(raw) < 32 {
+			return nil, fmt.Errorf("jwt key %s: HS256 secret must be at least 32 bytes", parts[0])
+		}
+		return &JWTKey{ID: parts[0], Alg: "HS256", secret: raw}, nil
+	case "EdDSA":
+		if len(raw) != ed25519.SeedSize {
+			return nil, fmt.Errorf("jwt key %s: EdDSA seed must be %d bytes", parts[0], ed25519.SeedSize)
+		}
+		priv := ed25519.NewKeyFromSeed(raw)
+		return &JWTKey{ID: parts[0], Alg: "EdDSA", private: priv, public: priv.Public().(ed25519.PublicKey)}, nil
+	default:
+		return nil, fmt.Errorf("jwt key %s: unsupported algorithm %q", parts[0], parts[1])
+	}
+}
+
+func decodeKeyMaterial(s string) ([]byte, error) {
+	s = strings.TrimRight(strings.TrimSpace(s), "=")
+	if b, err := base64.RawURLEncoding.DecodeString(s); err == nil {
+		return b, nil
+	}
+	return base64.RawStdEncoding.DecodeString(s)
+}
+
+func (k *JWTKey) sign(input []byte) []byte {
+	if k.Alg == "HS256" {
+		mac := hmac.New(sha256.New, k.secret)
+		mac.Write(input)
+		return mac.Sum(nil)
+	}
+	return ed25519.Sign(k.private, input)
+}
+
+func (k *JWTKey) verify(input, sig []byte) bool {
+	if k.Alg == "HS256" {
+		return hmac.Equal(k.sign(input), sig)
+	}
+	return ed25519.Verify(k.public, input, sig)
+}
+
+// JWTKeySet holds every key tokens may be verified with and the one new tokens are signed with.
+type JWTKeySet struct {
+	signing *JWTKey
+	keys    map[string]*JWTKey
+}
+
+// NewJWTKeySet builds a key set. signingKID selects the signing key; when
+// empty the first key is used.
+func NewJWTKeySet(keys []*JWTKey, signingKID string) (*JWTKeySet, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("no jwt keys configured")
+	}
+	ks := &JWTKeySet{keys: make(map[string]*JWTKey, len(keys))}
+	for _, k := range keys {
+		if _, dup := ks.keys[k.ID]; dup {
+			return nil, fmt.Errorf("duplicate jwt key id %q", k.ID)
+		}
+		ks.keys[k.ID] = k
+	}
+	if signingKID == "" {
+		signingKID = keys[0].ID
+	}
+	ks.signing = ks.keys[signingKID]
+	if ks.signing == nil {
+		return nil, fmt.Errorf("jwt signing key %q is not configured", signingKID)
+	}
+	return ks, nil
+}
+
+// GenerateJWTKeySet returns a set with a single random Ed25519 key. Tokens
+// signed with it stop validating when the process restarts.
+func GenerateJWTKeySet() (*JWTKeySet, error) {
+	seed := make([]byte, ed25519.SeedSize)
+	if _, err := rand.Read(seed); err != nil {
+		return nil, err
+	}
+	kid := make([]byte, 4)
+	if _, err := rand.Read(kid); err != nil {
+		return nil, err
+	}
+	priv := ed25519.NewKeyFromSeed(seed)
+	key := &JWTKey{ID: "ephemeral-" + hex.EncodeToString(kid), Alg: "EdDSA", private: priv, public: priv.Public().(ed25519.PublicKey)}
+	return NewJWTKeySet([]*JWTKey{key}, "")
+}
+
+var jwtKeys *JWTKeySet
+
+// SetJWTKeys injects the key set used to sign and verify access tokens.
+func SetJWTKeys(ks *JWTKeySet) {
+	jwtKeys = ks
+}
+
+// AccessClaims are the claims carried by an access token.
+type AccessClaims struct {
+	Subject   string `json:"sub"` // user id
+	SessionID int64  `json:"sid"` // sessions row the token was issued for
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+	ID        string `json:"jti"`
+}
+
+// UserID returns the subject as a user id.
+func (c *AccessClaims) UserID() int64 {
+	id, _ := strconv.ParseInt(c.Subject, 10, 64)
+	return id
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ,omitempty"`
+	Kid string `json:"kid"`
+}
+
+// SignAccessToken issues an access token for the user's session, valid for ttl.
+func SignAccessToken(userID, sessionID int64, ttl time.Duration) (string, time.Time, error) {
+	if jwtKeys == nil {
+		return "", time.Time{}, errors.New("jwt keys not configured")
+	}
+	jti, err := NewToken()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	now := time.Now()
+	exp := now.Add(ttl)
+	claims := AccessClaims{
+		Subject:   strconv.FormatInt(userID, 10),
+		SessionID: sessionID,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: exp.Unix(),
+		ID:        jti[:32],
+	}
+	key := jwtKeys.signing
+	header, _ := json.Marshal(jwtHeader{Alg: key.Alg, Typ: "JWT", Kid: key.ID})
+	payload, _ := json.Marshal(claims)
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	sig := key.sign([]byte(input))
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig), exp, nil
+}
+
+// ParseAccessToken verifies a token's signature and expiry and returns its claims.
+func ParseAccessToken(token string) (*AccessClaims, error) {
+	if jwtKeys == nil {
+		return nil, ErrInvalidToken
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+	rawHeader, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var h jwtHeader
+	if err := json.Unmarshal(rawHeader, &h); err != nil {
+		return nil, ErrInvalidToken
+	}
+	key := jwtKeys.keys[h.Kid]
+	// the algorithm is fixed by the key, never chosen by the token
+	if key == nil || h.Alg != key.Alg {
+		return nil, ErrInvalidToken
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !key.verify([]byte(parts[0]+"."+parts[1]), sig) {
+		return nil, ErrInvalidToken
+	}
+	rawClaims, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var c AccessClaims
+	if err := json.Unmarshal(rawClaims, &c); err != nil || c.Subject == "" {
+		return nil, ErrInvalidToken
+	}
+	if time.Now().Unix() >= c.ExpiresAt {
+		return nil, ErrInvalidToken
+	}
+	return &c, nil
+}
+
+// JWKS returns the public EdDSA keys as a JSON Web Key Set. HS256 secrets are
+// never published.
+func JWKS() map[string]interface{} {
+	keys := []map[string]string{}
+	if jwtKeys != nil {
+		for _, k := range jwtKeys.keys {
+			if k.Alg != "EdDSA" {
+				continue
+			}
+			keys = append(keys, map[string]string{
+				"kty": "OKP",
+				"crv": "Ed25519",
+				"alg": "EdDSA",
+				"use": "sig",
+				"kid": k.ID,
+				"x":   base64.RawURLEncoding.EncodeToString(k.public),
+			})
+		}
+	}
+	return map[string]interface{}{"keys": keys}
+}
+
+// BearerToken returns the token from an "Authorization: Bearer" header, or "".
+func BearerToken(r *http.Request) string {
+	h := r.Header.Get("Authorization")
+	if len(h) > 7 && strings.EqualFold(h[:7], "bearer ") {
+		return strings.TrimSpace(h[7:])
+	}
+	return ""
+}
@@ -0,0 +1,144 @@
+package utils
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testJWTKey(t *testing.T, kid, alg string, fill byte) *JWTKey {
+	t.Helper()
+	k, err := ParseJWTKey(kid + ":" + alg + ":" + base64.StdEncoding.EncodeToString([]byte(strings.Repeat(string(fill), 32))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func useJWTKeys(t *testing.T, signingKID string, keys ...*JWTKey) {
+	t.Helper()
+	ks, err := NewJWTKeySet(keys, signingKID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := jwtKeys
+	SetJWTKeys(ks)
+	t.Cleanup(func() { SetJWTKeys(prev) })
+}
+
+// craftJWT assembles a token from any header and claims, signed by key (or
+// not at all when key is nil).
+func craftJWT(header jwtHeader, claims AccessClaims, key *JWTKey) string {
+	h, _ := json.Marshal(header)
+	c, _ := json.Marshal(claims)
+	input := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+	var sig []byte
+	if key != nil {
+		sig = key.sign([]byte(input))
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestAccessTokenKeyRotation(t *testing.T) {
+	hs := testJWTKey(t, "hs-1", "HS256", 'a')
+	ed := testJWTKey(t, "ed-1", "EdDSA", 'b')
+
+	useJWTKeys(t, "hs-1", hs, ed)
+	oldToken, _, err := SignAccessToken(7, 3, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// rotate: sign with the new key, keep the old one for verification
+	useJWTKeys(t, "ed-1", hs, ed)
+	newToken, _, err := SignAccessToken(7, 3, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, token := range map[string]string{"old key": oldToken, "new key": newToken} {
+		c, err := ParseAccessToken(token)
+		if err != nil || c.UserID() != 7 || c.SessionID != 3 {
+			t.Errorf("%s: ParseAccessToken = %+v, %v", name, c, err)
+		}
+	}
+	var h jwtHeader
+	raw, _ := base64.RawURLEncoding.DecodeString(strings.Split(newToken, ".")[0])
+	json.Unmarshal(raw, &h)
+	if h.Kid != "ed-1" || h.Alg != "EdDSA" {
+		t.Errorf("new token header = %+v, want kid ed-1 and EdDSA", h)
+	}
+
+	// once the old key is dropped its tokens stop working
+	useJWTKeys(t, "ed-1", ed)
+	if _, err := ParseAccessToken(oldToken); err != ErrInvalidToken {
+		t.Errorf("token of a removed key: err = %v, want ErrInvalidToken", err)
+	}
+	if _, err := ParseAccessToken(newToken); err != nil {
+		t.Errorf("token of the remaining key: %v", err)
+	}
+}
+
+func TestParseAccessTokenRejectsForgeries(t *testing.T) {
+	hs := testJWTKey(t, "hs-1", "HS256", 'a')
+	ed := testJWTKey(t, "ed-1", "EdDSA", 'b')
+	useJWTKeys(t, "ed-1", hs, ed)
+
+	claims := AccessClaims{Subject: "7", SessionID: 3, IssuedAt: time.Now().Unix(), ExpiresAt: time.Now().Add(time.Minute).Unix(), ID: "x"}
+	valid := craftJWT(jwtHeader{Alg: "EdDSA", Typ: "JWT", Kid: "ed-1"}, claims, ed)
+	if _, err := ParseAccessToken(valid); err != nil {
+		t.Fatalf("well-formed token rejected: %v", err)
+	}
+	parts := strings.Split(valid, ".")
+	admin := claims
+	admin.Subject = "1"
+	expired := claims
+	expired.ExpiresAt = time.Now().Add(-time.Second).Unix()
+	// an HS256 "secret" that is really the published Ed25519 public key
+	confused := &JWTKey{ID: "ed-1", Alg: "HS256", secret: ed.public}
+
+	cases := []struct {
+		name  string
+		token string
+	}{
+		{"alg none", craftJWT(jwtHeader{Alg: "none", Kid: "ed-1"}, claims, nil)},
+		{"alg switched to HS256 with the public key", craftJWT(jwtHeader{Alg: "HS256", Kid: "ed-1"}, claims, confused)},
+		{"alg of another key", craftJWT(jwtHeader{Alg: "EdDSA", Kid: "hs-1"}, claims, ed)},
+		{"unknown kid", craftJWT(jwtHeader{Alg: "EdDSA", Kid: "ed-2"}, claims, ed)},
+		{"missing kid", craftJWT(jwtHeader{Alg: "EdDSA"}, claims, ed)},
+		{"tampered claims", parts[0] + "." + strings.Split(craftJWT(jwtHeader{Alg: "EdDSA", Kid: "ed-1"}, admin, nil), ".")[1] + "." + parts[2]},
+		{"tampered signature", parts[0] + "." + parts[1] + "." + base64.RawURLEncoding.EncodeToString(make([]byte, 64))},
+		{"signature stripped", parts[0] + "." + parts[1] + "."},
+		{"expired", craftJWT(jwtHeader{Alg: "EdDSA", Kid: "ed-1"}, expired, ed)},
+		{"no subject", craftJWT(jwtHeader{Alg: "EdDSA", Kid: "ed-1"}, AccessClaims{ExpiresAt: claims.ExpiresAt}, ed)},
+		{"two parts", parts[0] + "." + parts[1]},
+		{"garbage", "not.a.jwt"},
+	}
+	for _, tc := range cases {
+		if c, err := ParseAccessToken(tc.token); err != ErrInvalidToken {
+			t.Errorf("%s: ParseAccessToken = %+v, %v; want ErrInvalidToken", tc.name, c, err)
+		}
+	}
+}
+
+func TestParseJWTKey(t *testing.T) {
+	seed := base64.RawURLEncoding.EncodeToString([]byte(strings.Repeat("s", 32)))
+	cases := []struct {
+		spec    string
+		wantErr bool
+	}{
+		{"k1:HS256:" + seed, false},
+		{"k1:EdDSA:" + seed, false},
+		{"k1:HS256:" + base64.StdEncoding.EncodeToString([]byte("too short")), true},
+		{"k1:EdDSA:" + base64.StdEncoding.EncodeToString([]byte("not a 32-byte seed")), true},
+		{"k1:RS256:" + seed, true},
+		{":HS256:" + seed, true},
+		{"k1:" + seed, true},
+	}
+	for _, tc := range cases {
+		if _, err := ParseJWTKey(tc.spec); (err != nil) != tc.wantErr {
+			t.Errorf("ParseJWTKey(%q) error = %v, want error %v", tc.spec, err, tc.wantErr)
+		}
+	}
+}
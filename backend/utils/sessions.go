@@ -2,9 +2,15 @@ package utils
 
 import (
 	"database/sql"
+	"net"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
+
+	"social-network/backend/config"
+
+	"github.com/google/uuid"
 )
 
 var db *sql.DB
@@ -20,8 +26,24 @@ type contextKey string
 // UserIDKey is used to store/retrieve the user ID in request context.
 const UserIDKey contextKey = "userID"
 
-// GetUserIDFromSession extracts the user ID from the session cookie
+// SessionIDKey is used to store/retrieve the current session row ID in request context.
+const SessionIDKey contextKey = "sessionID"
+
+// SessionTTL is how long a newly issued session stays valid.
+const SessionTTL = 24 * time.Hour
+
+// GetUserIDFromSession extracts the user ID from the session cookie.
+// Suspended users count as signed out.
 func GetUserIDFromSession(w http.ResponseWriter, r *http.Request) string {
+	// API clients authenticate with a bearer access token instead
+	if token := BearerToken(r); token != "" {
+		claims, err := ParseAccessToken(token)
+		if err != nil || !SessionActive(claims.UserID(), claims.SessionID) || isSuspended(claims.UserID()) {
+			return ""
+		}
+		return claims.Subject
+	}
+
 	// use the same cookie name as the auth handlers: session_token
 	cookie, err := r.Cookie("session_token")
 	if err != nil {
@@ -35,10 +57,141 @@ func GetUserIDFromSession(w http.ResponseWriter, r *http.Request) string {
 		expireCookie(w, "session_token")
 		return ""
 	}
+	if isSuspended(userIDInt) {
+		return ""
+	}
 
 	return strconv.FormatInt(userIDInt, 10)
 }
 
+// SessionActive reports whether the user's session exists and hasn't
+// expired, e.g. the one an access token was issued for.
+func SessionActive(userID, sessionID int64) bool {
+	var n int
+	db.QueryRow("SELECT COUNT(1) FROM sessions WHERE id = ? AND user_id = ? AND expiry > ?", sessionID, userID, time.Now()).Scan(&n)
+	return n > 0
+}
+
+// isSuspended reports whether the user is currently suspended, like
+// handlers.ActiveSuspension but without lifting an expired suspension.
+func isSuspended(userID int64) bool {
+	var n int
+	db.QueryRow("SELECT COUNT(1) FROM users WHERE id = ? AND suspended_at IS NOT NULL AND (suspended_until IS NULL OR suspended_until > ?)",
+		userID, time.Now()).Scan(&n)
+	return n > 0
+}
+
+// CreateSession stores a new session for the user, recording the device's
+// user agent and IP, and sets the session cookie on the response. Existing
+// sessions of the user are left untouched so several devices can stay signed in.
+func CreateSession(w http.ResponseWriter, r *http.Request, userID int64) (string, error) {
+	sessionToken := uuid.New().String()
+	expiry := time.Now().Add(SessionTTL)
+	if _, err := insertSession(r, userID, sessionToken, expiry); err != nil {
+		return "", err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     "session_token",
+		Value:    sessionToken,
+		Path:     "/",
+		Expires:  expiry,
+		HttpOnly: true,
+		Secure:   r.TLS != nil, // only secure in HTTPS
+		SameSite: http.SameSiteStrictMode,
+	})
+	return sessionToken, nil
+}
+
+// CreateTokenSession stores a session for an API client that authenticates
+// with access/refresh tokens rather than the cookie, and returns its row ID.
+// It shows up (and can be revoked) alongside the user's browser sessions.
+func CreateTokenSession(r *http.Request, userID int64, expiry time.Time) (int64, error) {
+	// cookie_token must be unique; this one is never handed out
+	return insertSession(r, userID, uuid.New().String(), expiry)
+}
+
+func insertSession(r *http.Request, userID int64, cookieToken string, expiry time.Time) (int64, error) {
+	now := time.Now()
+	res, err := db.Exec(
+		`INSERT INTO sessions (user_id, cookie_token, expiry, user_agent, ip_address, created_at, last_seen_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		userID, cookieToken, expiry, r.UserAgent(), ClientIP(r), now, now,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// RevokeSession deletes a single session, scoped to its owner.
+// It reports whether a session was actually removed.
+func RevokeSession(userID, sessionID int64) (bool, error) {
+	res, err := db.Exec("DELETE FROM sessions WHERE id = ? AND user_id = ?", sessionID, userID)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// RevokeUserSessions deletes every session of a user except exceptID
+// (pass 0 to delete them all) and returns how many were removed.
+func RevokeUserSessions(userID, exceptID int64) (int64, error) {
+	res, err := db.Exec("DELETE FROM sessions WHERE user_id = ? AND id != ?", userID, exceptID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// ClientIP returns the caller's IP address. Proxy headers are only believed
+// when the connection comes from one of config.TrustedProxies, and then the
+// address used is the right-most X-Forwarded-For entry that isn't a trusted
+// proxy: everything to its left was supplied by the client and could be made up.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !trustedProxy(net.ParseIP(host)) {
+		return host
+	}
+	if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+		hops := strings.Split(fwd, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			ip := net.ParseIP(strings.TrimSpace(hops[i]))
+			if ip == nil {
+				break
+			}
+			if i == 0 || !trustedProxy(ip) {
+				return ip.String()
+			}
+		}
+		return host
+	}
+	if ip := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); ip != nil {
+		return ip.String()
+	}
+	return host
+}
+
+// trustedProxy reports whether ip is listed in config.TrustedProxies.
+func trustedProxy(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, entry := range config.Current.TrustedProxies {
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			if network.Contains(ip) {
+				return true
+			}
+		} else if ip.Equal(net.ParseIP(entry)) {
+			return true
+		}
+	}
+	return false
+}
+
 func expireCookie(w http.ResponseWriter, name string) {
 	http.SetCookie(w, &http.Cookie{
 		Name:     name,
@@ -50,6 +203,11 @@ func expireCookie(w http.ResponseWriter, name string) {
 	})
 }
 
+// ExpireSessionCookie clears the session cookie client-side.
+func ExpireSessionCookie(w http.ResponseWriter) {
+	expireCookie(w, "session_token")
+}
+
 // GetUserIDFromContext reads the user id string placed into the request context by AuthMiddleware
 func GetUserIDFromContext(r *http.Request) string {
 	if v := r.Context().Value(UserIDKey); v != nil {
@@ -59,3 +217,14 @@ func GetUserIDFromContext(r *http.Request) string {
 	}
 	return ""
 }
+
+// GetSessionIDFromContext reads the session row ID placed into the request context by AuthMiddleware.
+// It returns 0 when the request was not authenticated through a session.
+func GetSessionIDFromContext(r *http.Request) int64 {
+	if v := r.Context().Value(SessionIDKey); v != nil {
+		if id, ok := v.(int64); ok {
+			return id
+		}
+	}
+	return 0
+}
@@ -0,0 +1,158 @@
+package utils
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"social-network/backend/config"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestClientIP(t *testing.T) {
+	prev := config.Current.TrustedProxies
+	config.Current.TrustedProxies = []string{"10.0.0.0/8", "192.0.2.1"}
+	t.Cleanup(func() { config.Current.TrustedProxies = prev })
+
+	cases := []struct {
+		name, remote, forwarded, realIP, want string
+	}{
+		{"direct", "203.0.113.7:5000", "", "", "203.0.113.7"},
+		{"untrusted peer can't spoof XFF", "203.0.113.7:5000", "1.2.3.4", "", "203.0.113.7"},
+		{"untrusted peer can't spoof X-Real-IP", "203.0.113.7:5000", "", "1.2.3.4", "203.0.113.7"},
+		{"trusted proxy", "10.1.2.3:80", "198.51.100.9", "", "198.51.100.9"},
+		{"trusted single address", "192.0.2.1:80", "198.51.100.9", "", "198.51.100.9"},
+		{"client-supplied entries are skipped", "10.1.2.3:80", "1.2.3.4, 198.51.100.9", "", "198.51.100.9"},
+		{"proxy chain", "10.1.2.3:80", "198.51.100.9, 10.9.9.9", "", "198.51.100.9"},
+		{"only proxies", "10.1.2.3:80", "10.9.9.9", "", "10.9.9.9"},
+		{"garbage in XFF", "10.1.2.3:80", "not-an-ip", "", "10.1.2.3"},
+		{"X-Real-IP from trusted proxy", "10.1.2.3:80", "", "198.51.100.9", "198.51.100.9"},
+		{"IPv6 peer", "[2001:db8::1]:443", "1.2.3.4", "", "2001:db8::1"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tc.remote
+			if tc.forwarded != "" {
+				r.Header.Set("X-Forwarded-For", tc.forwarded)
+			}
+			if tc.realIP != "" {
+				r.Header.Set("X-Real-IP", tc.realIP)
+			}
+			if got := ClientIP(r); got != tc.want {
+				t.Errorf("ClientIP = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+// useTestDB gives the test a database with just the tables sessions need.
+func useTestDB(t *testing.T) {
+	t.Helper()
+	conn, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, q := range []string{
+		"CREATE TABLE users (id INTEGER PRIMARY KEY, suspended_at DATETIME, suspended_until DATETIME)",
+		"CREATE TABLE sessions (id INTEGER PRIMARY KEY, user_id INTEGER, cookie_token TEXT, expiry DATETIME)",
+	} {
+		if _, err := conn.Exec(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	prev := db
+	db = conn
+	t.Cleanup(func() {
+		db = prev
+		conn.Close()
+	})
+}
+
+func TestGetUserIDFromSessionIgnoresSuspendedUsers(t *testing.T) {
+	useTestDB(t)
+	keys, err := GenerateJWTKeySet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	prevKeys := jwtKeys
+	SetJWTKeys(keys)
+	t.Cleanup(func() { SetJWTKeys(prevKeys) })
+
+	now := time.Now()
+	db.Exec("INSERT INTO users (id, suspended_at, suspended_until) VALUES (1, NULL, NULL), (2, ?, NULL), (3, ?, ?), (4, ?, ?)",
+		now, now, now.Add(time.Hour), now.Add(-2*time.Hour), now.Add(-time.Hour))
+	cases := []struct {
+		userID int64
+		want   string
+	}{
+		{1, "1"}, // never suspended
+		{2, ""},  // banned
+		{3, ""},  // suspended for another hour
+		{4, "4"}, // suspension over
+	}
+	for _, tc := range cases {
+		cookie := fmt.Sprintf("cookie-%d", tc.userID)
+		res, err := db.Exec("INSERT INTO sessions (user_id, cookie_token, expiry) VALUES (?, ?, ?)", tc.userID, cookie, now.Add(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sessionID, _ := res.LastInsertId()
+		token, _, err := SignAccessToken(tc.userID, sessionID, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		if got := GetUserIDFromSession(httptest.NewRecorder(), r); got != tc.want {
+			t.Errorf("user %d with an access token: got %q, want %q", tc.userID, got, tc.want)
+		}
+
+		r = httptest.NewRequest("GET", "/", nil)
+		r.AddCookie(&http.Cookie{Name: "session_token", Value: cookie})
+		if got := GetUserIDFromSession(httptest.NewRecorder(), r); got != tc.want {
+			t.Errorf("user %d with a session cookie: got %q, want %q", tc.userID, got, tc.want)
+		}
+	}
+}
+
+func TestGetUserIDFromSessionNeedsTheTokensSession(t *testing.T) {
+	useTestDB(t)
+	keys, err := GenerateJWTKeySet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	prevKeys := jwtKeys
+	SetJWTKeys(keys)
+	t.Cleanup(func() { SetJWTKeys(prevKeys) })
+
+	db.Exec("INSERT INTO users (id) VALUES (1), (2)")
+	db.Exec("INSERT INTO sessions (id, user_id, cookie_token, expiry) VALUES (10, 1, 'a', ?), (11, 1, 'b', ?)",
+		time.Now().Add(time.Hour), time.Now().Add(-time.Minute))
+	cases := []struct {
+		name              string
+		userID, sessionID int64
+		want              string
+	}{
+		{"live session", 1, 10, "1"},
+		{"expired session", 1, 11, ""},
+		{"revoked session", 1, 12, ""},
+		{"someone else's session", 2, 10, ""},
+	}
+	for _, tc := range cases {
+		token, _, err := SignAccessToken(tc.userID, tc.sessionID, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		if got := GetUserIDFromSession(httptest.NewRecorder(), r); got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 seed of the RFC 6238 test vectors, "12345678901234567890".
+var rfc6238Secret = b32.EncodeToString([]byte("12345678901234567890"))
+
+func TestValidateTOTPRFC6238Vectors(t *testing.T) {
+	// RFC 6238 appendix B gives 8 digits; 6-digit codes are their last six
+	cases := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tc := range cases {
+		step, ok := ValidateTOTP(rfc6238Secret, tc.code, time.Unix(tc.unix, 0))
+		if !ok || step != tc.unix/totpPeriod {
+			t.Errorf("ValidateTOTP(%s at %d) = %d, %v; want step %d", tc.code, tc.unix, step, ok, tc.unix/totpPeriod)
+		}
+	}
+}
+
+func TestValidateTOTPWindow(t *testing.T) {
+	const at = 1234567890 // step 41152263
+	code := "005924"
+	cases := []struct {
+		name   string
+		offset time.Duration
+		want   bool
+	}{
+		{"same step", 0, true},
+		{"phone one step behind", 30 * time.Second, true},
+		{"phone one step ahead", -30 * time.Second, true},
+		{"two steps behind", 60 * time.Second, false},
+		{"two steps ahead", -60 * time.Second, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			step, ok := ValidateTOTP(rfc6238Secret, code, time.Unix(at, 0).Add(tc.offset))
+			if ok != tc.want {
+				t.Fatalf("ValidateTOTP = %v, want %v", ok, tc.want)
+			}
+			if ok && step != at/totpPeriod {
+				t.Errorf("matched step %d, want the code's own step %d", step, at/totpPeriod)
+			}
+		})
+	}
+}
+
+func TestValidateTOTPRejectsMalformedInput(t *testing.T) {
+	at := time.Unix(1234567890, 0)
+	cases := []struct{ name, secret, code string }{
+		{"short code", rfc6238Secret, "05924"},
+		{"long code", rfc6238Secret, "0005924"},
+		{"wrong code", rfc6238Secret, "005925"},
+		{"bad secret", "not base32!", "005924"},
+	}
+	for _, tc := range cases {
+		if _, ok := ValidateTOTP(tc.secret, tc.code, at); ok {
+			t.Errorf("%s: accepted", tc.name)
+		}
+	}
+	// spaces, as some apps show "005 924", are ignored
+	if _, ok := ValidateTOTP(rfc6238Secret, " 005 924 ", at); !ok {
+		t.Error("code with spaces rejected")
+	}
+}
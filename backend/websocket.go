@@ -25,9 +25,7 @@ var (
 	upgrader = websocket.Upgrader{
 		ReadBufferSize:  1024,
 		WriteBufferSize: 1024,
-		CheckOrigin: func(r *http.Request) bool {
-			return true
-		},
+		CheckOrigin:     checkWSOrigin,
 	}
 	clients      = make(map[string]*Client)
 	clientsMutex sync.RWMutex
@@ -48,6 +46,12 @@ func HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	id, _ := strconv.ParseInt(userID, 10, 64)
+	if s := handlers.ActiveSuspension(id); s != nil {
+		handlers.WriteSuspended(w, s)
+		return
+	}
+
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Println("WebSocket upgrade error:", err)
@@ -88,6 +92,21 @@ func HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 	go client.writePump()
 }
 
+// disconnectClient closes a user's websocket, telling the client why. It is
+// registered with bus.SetDisconnectHandler so handlers can drop connections
+// of suspended users.
+func disconnectClient(userID int64) {
+	clientsMutex.Lock()
+	client, ok := clients[strconv.FormatInt(userID, 10)]
+	clientsMutex.Unlock()
+	if !ok {
+		return
+	}
+	msg := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "session revoked")
+	client.Conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+	client.Conn.Close() // triggers cleanup in readPump()
+}
+
 func (c *Client) readPump() {
 	defer func() {
 		c.Conn.Close()
@@ -131,6 +150,17 @@ func (c *Client) readPump() {
 			}
 		}
 
+		// unverified accounts may be barred from chatting by policy
+		if raw.Type == "message" || raw.Type == "group_message" {
+			senderIDInt, _ := strconv.ParseInt(c.ID, 10, 64)
+			if handlers.VerificationRequired(senderIDInt, "message") {
+				errMsg := models.Message{Type: "error", Content: "Please verify your email address before sending messages."}
+				payload, _ := json.Marshal(errMsg)
+				c.Send <- payload
+				continue
+			}
+		}
+
 		// DM (direct message)
 		if raw.Type == "message" {
 			// enforce allowed users: either follows the other
@@ -173,6 +203,7 @@ func (c *Client) readPump() {
 				SenderID:   c.ID,
 				SenderName: c.Nickname,
 				ReceiverID: raw.ReceiverID,
+				Mentions:   handlers.SaveMentions(handlers.MessageMentionTarget(msgID, receiverIDInt), raw.Content, senderIDInt),
 			}
 
 			// parse createdAt (DB returns string) and set CreatedAt on outgoing message
@@ -238,6 +269,7 @@ func (c *Client) readPump() {
 				"content":     raw.Content,
 				"sender_id":   c.ID,
 				"sender_name": c.Nickname,
+				"mentions":    handlers.SaveMentions(handlers.GroupMessageMentionTarget(gmID, raw.GroupID), raw.Content, senderIDInt),
 			}
 			encoded, _ := json.Marshal(out)
 
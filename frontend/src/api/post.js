@@ -5,13 +5,70 @@ export const createPost = async (postData) => {
   return res.data;
 }
 
+// listPostsPage returns { posts, next_cursor }; pass next_cursor back to get the following page
+export const listPostsPage = async (user_id, cursor, limit) => {
+  const params = {};
+  if (user_id) params.user_id = user_id;
+  if (cursor) params.cursor = cursor;
+  if (limit) params.limit = limit;
+  const res = await api.get('/posts', { params });
+  return res.data;
+}
+
 export const listPosts = async (user_id) => {
-  const url = user_id ? `/posts?user_id=${user_id}` : '/posts';
-  const res = await api.get(url);
+  const page = await listPostsPage(user_id);
+  return page.posts;
+}
+
+// getPost returns one post with its comments, or fails with 404 if it's hidden from the user
+export const getPost = async (post_id) => {
+  const res = await api.get(`/posts/${post_id}`);
+  return res.data;
+}
+
+// updatePost takes { post_id, content, image_url, privacy, allowed }; fields left out are unchanged
+export const updatePost = async (changes) => {
+  const res = await api.post('/posts/update', changes);
+  return res.data;
+}
+
+export const deletePost = async (post_id) => {
+  const res = await api.post('/posts/delete', { post_id });
+  return res.data;
+}
+
+export const listPostRevisions = async (post_id) => {
+  const res = await api.get('/posts/revisions', { params: { post_id } });
+  return res.data.revisions;
+}
+
+export const addComment = async (post_id, content, image_url, parent_id) => {
+  const res = await api.post('/posts/comment', { post_id, content, image_url, parent_id });
+  return res.data;
+}
+
+export const updateComment = async (comment_id, content, image_url) => {
+  const res = await api.post('/posts/comment/update', { comment_id, content, image_url });
+  return res.data;
+}
+
+export const deleteComment = async (comment_id, reason) => {
+  const res = await api.post('/posts/comment/delete', { comment_id, reason });
+  return res.data;
+}
+
+// listReplies returns { replies, next_cursor } for a comment, oldest first
+export const listReplies = async (comment_id, cursor, limit) => {
+  const params = { comment_id };
+  if (cursor) params.cursor = cursor;
+  if (limit) params.limit = limit;
+  const res = await api.get('/posts/comment/replies', { params });
   return res.data;
 }
 
-export const addComment = async (post_id, content, image_url) => {
-  const res = await api.post('/posts/comment', { post_id, content, image_url });
+// toggleReaction sets the user's reaction on a post, comment, group_post or
+// group_comment; sending the current one again removes it
+export const toggleReaction = async (target_type, target_id, reaction) => {
+  const res = await api.post('/reactions', { target_type, target_id, reaction });
   return res.data;
 }